@@ -6,9 +6,12 @@ require (
 	github.com/JohannesKaufmann/html-to-markdown v1.6.0
 	github.com/PuerkitoBio/goquery v1.9.2 // Switched to goquery for easier DOM traversal
 	github.com/google/uuid v1.6.0
+	golang.org/x/image v0.18.0 // draw for -max-image-dimension downscaling; bmp, tiff, webp decoders for PNG conversion
+	golang.org/x/net v0.25.0 // html/charset for non-UTF-8 exports
 )
 
 require (
 	github.com/andybalholm/cascadia v1.3.2 // indirect
-	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
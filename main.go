@@ -2,42 +2,107 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"log"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/plugin"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/google/uuid"
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/net/html/charset"
 )
 
 // --- Day One Data Structures ---
+// Fields are in the order of Day One's own export (see testdata/dayone-reference/Journal.json),
+// which encoding/json keeps; fields Day One doesn't read come last.
 type DayOnePhoto struct {
-	MD5          string `json:"md5"`
+	Identifier   string `json:"identifier"`
 	Type         string `json:"type"`
+	MD5          string `json:"md5"`
+	CreationDate string `json:"creationDate"`           // ISO 8601
+	Width        int    `json:"width,omitempty"`        // Pixels, when the image could be decoded
+	Height       int    `json:"height,omitempty"`       // Pixels, when the image could be decoded
+	OrderInEntry *int   `json:"orderInEntry,omitempty"` // Set by -cover-photo; Day One's timeline thumbnail is photo 0
+
+	source string // Export file or remote URL the photo came from, before any conversion (for -media-manifest)
+}
+
+type DayOneVideo struct {
+	Identifier   string `json:"identifier"`
+	Type         string `json:"type"` // e.g. "mov", "mp4"
+	MD5          string `json:"md5"`
+	CreationDate string `json:"creationDate"` // ISO 8601
+}
+
+type DayOneAudio struct {
 	Identifier   string `json:"identifier"`
+	Format       string `json:"format"` // e.g. "m4a"
+	MD5          string `json:"md5"`
 	CreationDate string `json:"creationDate"` // ISO 8601
-	// Width        int    `json:"width,omitempty"` // Not implementing for simplicity
-	// Height       int    `json:"height,omitempty"`// Not implementing for simplicity
 }
 
 type DayOneEntry struct {
-	UUID         string        `json:"uuid"`
-	CreationDate string        `json:"creationDate"` // ISO 8601
-	ModifiedDate string        `json:"modifiedDate"` // ISO 8601
-	Text         string        `json:"text"`
-	Starred      bool          `json:"starred"`
-	TimeZone     string        `json:"timeZone"`
-	Photos       []DayOnePhoto `json:"photos,omitempty"`
+	UUID               string `json:"uuid"`
+	CreationDate       string `json:"creationDate"` // ISO 8601
+	ModifiedDate       string `json:"modifiedDate"` // ISO 8601
+	TimeZone           string `json:"timeZone"`
+	Starred            bool   `json:"starred"`
+	IsPinned           bool   `json:"isPinned,omitempty"`
+	CreationDevice     string `json:"creationDevice,omitempty"`     // e.g. "Mike's iPhone"
+	CreationDeviceType string `json:"creationDeviceType,omitempty"` // e.g. "iPhone"
+	CreationOSName     string `json:"creationOSName,omitempty"`     // e.g. "iOS"
 	// Location (omitted as per user request)
-	// Tags (omitted, not found in sample)
+
+	Tags     []string      `json:"tags,omitempty"`
+	Text     string        `json:"text"`
+	RichText string        `json:"richText,omitempty"` // JSON encoded richTextDocument
+	Photos   []DayOnePhoto `json:"photos,omitempty"`
+	Videos   []DayOneVideo `json:"videos,omitempty"`
+	Audios   []DayOneAudio `json:"audios,omitempty"`
+
+	PlainText        string   `json:"plainText,omitempty"`        // Body without markdown syntax (-plain-text), not read by Day One
+	WordCount        int      `json:"wordCount,omitempty"`        // Words of the plain-text body (-word-count), not read by Day One
+	PreviousVersions []string `json:"previousVersions,omitempty"` // Earlier versions of the text (-edit-history field), not read by Day One
+
+	title      string // Extracted title, kept for Markdown output filenames (not part of the Day One format)
+	suggested  bool   // Classified as an Apple Journal suggestion rather than user-written (see -suggested)
+	sourceFile string // HTML file the entry came from, relative to the export root with slashes, to resolve its links
 }
 
 type DayOneJournal struct {
@@ -45,17 +110,675 @@ type DayOneJournal struct {
 	Entries  []DayOneEntry     `json:"entries"`
 }
 
+// --- Errors ---
+// processEntryHTML wraps these so callers can tell skip reasons apart with errors.Is.
+// ErrMissingMedia comes with the converted entries, which are kept without that media.
+var (
+	ErrUnsupportedLayout = errors.New("unexpected HTML structure")
+	ErrNoDate            = errors.New("no date found in pageHeader")
+	ErrUnparseableDate   = errors.New("could not parse date")
+	ErrEmptyEntry        = errors.New("empty entry")
+	ErrInvalidEntry      = errors.New("missing required Day One field")
+	ErrMissingMedia      = errors.New("media file not found")
+)
+
+// skipCategory names the reason an entry was skipped, for the summary counts.
+func skipCategory(err error) string {
+	switch {
+	case errors.Is(err, ErrUnsupportedLayout):
+		return "unsupported layout"
+	case errors.Is(err, ErrNoDate):
+		return "no date"
+	case errors.Is(err, ErrUnparseableDate):
+		return "unparseable date"
+	case errors.Is(err, ErrEmptyEntry):
+		return "empty entry"
+	case errors.Is(err, ErrInvalidEntry):
+		return "invalid entry"
+	case errors.Is(err, ErrMissingMedia):
+		return "missing media"
+	default:
+		return "other error"
+	}
+}
+
+// isEmptyEntry reports whether an entry has neither text nor any attached media.
+func isEmptyEntry(entry DayOneEntry) bool {
+	return entry.Text == "" && len(entry.Photos) == 0 && len(entry.Videos) == 0 && len(entry.Audios) == 0
+}
+
+// validateEntry checks the fields Day One requires on every entry; one entry missing
+// any of them can make Day One reject the whole import.
+func validateEntry(entry DayOneEntry) error {
+	required := []struct{ name, value string }{
+		{"uuid", entry.UUID},
+		{"creationDate", entry.CreationDate},
+		{"modifiedDate", entry.ModifiedDate},
+		{"timeZone", entry.TimeZone},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			return fmt.Errorf("%w: %s", ErrInvalidEntry, field.name)
+		}
+	}
+	return nil
+}
+
+// skippedEntry is an HTML file that was not converted, for -list-skipped.
+type skippedEntry struct {
+	File   string // Relative to the entries folder
+	Reason string
+}
+
+// writeSkippedList writes the skipped files grouped by skip category to dest, or to stdout if dest is "-".
+func writeSkippedList(dest string, skipped map[string][]skippedEntry) error {
+	var b strings.Builder
+	categories := make([]string, 0, len(skipped))
+	for category := range skipped {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		entries := skipped[category]
+		sort.Slice(entries, func(i, j int) bool { return entries[i].File < entries[j].File })
+		fmt.Fprintf(&b, "%s (%d):\n", category, len(entries))
+		for _, e := range entries {
+			fmt.Fprintf(&b, "  %s: %s\n", e.File, e.Reason)
+		}
+	}
+	if len(categories) == 0 {
+		b.WriteString("No entries were skipped.\n")
+	}
+	if dest == "-" {
+		_, err := fmt.Print(b.String())
+		return err
+	}
+	if err := os.WriteFile(dest, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	log.Printf("Wrote the list of skipped entries to %s", dest)
+	return nil
+}
+
+// writeMediaManifest writes a CSV row for each photo, video and audio file of the entries to dest, or to
+// stdout if dest is "-": the entry it belongs to, its identifier and path in the zip, the source file
+// (relative to sourceRoot, the extraction directory), its MD5, type and dimensions. Photos list the export
+// file they came from even when a downscaled or transcoded copy is zipped; entries restored by -resume
+// don't remember it, so theirs show the file that is copied instead.
+func writeMediaManifest(dest string, entries []DayOneEntry, media map[string]string, sourceRoot string) error {
+	// Media zip paths are named after the identifier
+	zipPathByID := make(map[string]string, len(media))
+	for zipPath := range media {
+		zipPathByID[strings.TrimSuffix(filepath.Base(zipPath), filepath.Ext(zipPath))] = zipPath
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"entry_uuid", "kind", "identifier", "zip_path", "source_file", "md5", "type", "width", "height"})
+	row := func(entryUUID, kind, identifier, source, md5Hash, mediaType string, width, height int) {
+		zipPath, sourcePath := zipPathByID[identifier], source
+		if sourcePath == "" {
+			sourcePath = media[zipPath]
+		}
+		if !isRemoteURL(sourcePath) {
+			if rel, err := filepath.Rel(sourceRoot, sourcePath); err == nil && !strings.HasPrefix(rel, "..") {
+				sourcePath = rel
+			}
+		}
+		size := []string{"", ""}
+		if width > 0 && height > 0 {
+			size = []string{strconv.Itoa(width), strconv.Itoa(height)}
+		}
+		w.Write(append([]string{entryUUID, kind, identifier, filepath.ToSlash(zipPath), filepath.ToSlash(sourcePath), md5Hash, mediaType}, size...))
+	}
+	for _, entry := range entries {
+		for _, photo := range entry.Photos {
+			row(entry.UUID, "photo", photo.Identifier, photo.source, photo.MD5, photo.Type, photo.Width, photo.Height)
+		}
+		for _, video := range entry.Videos {
+			row(entry.UUID, "video", video.Identifier, "", video.MD5, video.Type, 0, 0)
+		}
+		for _, audio := range entry.Audios {
+			row(entry.UUID, "audio", audio.Identifier, "", audio.MD5, audio.Format, 0, 0)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if dest == "-" {
+		_, err := os.Stdout.Write(b.Bytes())
+		return err
+	}
+	if err := os.WriteFile(dest, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	log.Printf("Wrote the media manifest to %s", dest)
+	return nil
+}
+
+// --- Conversion Options ---
+
+// entryOptions controls how individual Apple Journal HTML entries are converted.
+type entryOptions struct {
+	DefaultTimeZone    string             // Olson timezone assigned to entries
+	TimeZoneMap        timeZoneMap        // Per-entry timezones from -tz-per-entry-file, overriding DefaultTimeZone
+	TitleFromFilename  bool               // Fall back to the filename for the title when the HTML has none
+	RichText           bool               // Also generate Day One's richText representation
+	PlainText          bool               // Also store a plain-text rendering of the body in plainText
+	WordCount          bool               // Count the words of the plain-text body into wordCount
+	FlattenMarkdown    bool               // Build the body with flattenToMarkdown instead of markdownConverter (faster, less faithful)
+	StripEmoji         bool               // Remove emoji from titles and text
+	VerboseErrors      bool               // Log the relevant HTML when an entry is skipped
+	DebugDir           string             // Directory HTML fragments that fail markdown conversion are written to ("" disables)
+	StarSelector       string             // CSS selector whose presence marks an entry as starred ("" disables detection)
+	PinSelector        string             // CSS selector whose presence marks an entry as pinned ("" disables detection)
+	SuggestedSelector  string             // CSS selector marking an entry as started from a suggestion ("" disables detection)
+	RevisionSelector   string             // CSS selector of blocks holding a previous version of the text ("" disables detection)
+	EditHistory        string             // editHistoryLatest/editHistoryAppend/editHistoryField: what to do with previous versions
+	TagSuggested       bool               // Tag entries classified as suggested with "suggested"
+	DedupPhotoFormats  bool               // Keep one photo when the same image exists in several formats
+	TagSource          bool               // Tag entries with source/<html filename>
+	DeviceName         string             // creationDevice for all entries
+	DeviceOSName       string             // creationOSName for all entries
+	NoMedia            bool               // Skip all media (text-only conversion)
+	PreserveWhitespace bool               // Keep monospace-styled blocks verbatim in fenced code blocks
+	MaxImageDimension  int                // Downscale photos whose width or height exceeds this (0: keep originals)
+	ConvertedMediaDir  string             // Directory downscaled and transcoded photos are written to until zipped
+	ImageTypes         map[string]bool    // Lowercase photo extensions to accept, with the dot (see parseImageTypes)
+	MediaSubdirByEntry bool               // Write media to photos/<entry uuid>/ etc. instead of flat folders
+	TitleFormat        *template.Template // -title-format template for the title injected above the text (nil: "# Title")
+	UntitledLabel      string             // Title for entries without one ("" leaves them untitled, untitledFirstWords uses the body)
+	BaseDate           time.Time          // Placeholder date for entries without header or filename date (zero: skip them)
+	DateLayouts        []string           // Extra Go time layouts for header dates, tried after the built-in ones
+	ExtractBodyTimes   bool               // Take the time of day of date-only entries from a time starting a body line
+	KeepEmpty          bool               // Keep dated entries without content, with emptyEntryPlaceholder as their text
+	CoverPhoto         string             // coverPhotoFirst/coverPhotoLargest order photos so that one is the thumbnail (coverPhotoNone: unset)
+
+	FetchRemote    bool          // Download images referenced by http(s) URL
+	FetchTimeout   time.Duration // Timeout for each remote image download
+	RemoteMediaDir string        // Directory downloaded images are stored in until zipped
+}
+
+// journalAppReleaseDate is the release of Apple's Journal app (iOS 17.2), the default -min-date:
+// earlier entries are possible (entry dates can be changed) but are often a misparsed date.
+const journalAppReleaseDate = "2023-12-11"
+
+// emptyEntryPlaceholder is the (italicized) text of entries kept by -keep-empty.
+const emptyEntryPlaceholder = "No content in the Apple Journal export."
+
+// --- Day One Rich Text ---
+// Newer Day One versions store a JSON "richText" document next to the markdown text.
+// It's a flat list of runs, each carrying text (or embedded objects) plus formatting attributes.
+
+type richTextDocument struct {
+	Contents []richTextRun `json:"contents"`
+	Meta     richTextMeta  `json:"meta"`
+}
+
+type richTextMeta struct {
+	Version           int  `json:"version"`
+	SmallLinesRemoved bool `json:"small-lines-removed"`
+}
+
+type richTextRun struct {
+	Text            string                   `json:"text,omitempty"`
+	Attributes      *richTextAttributes      `json:"attributes,omitempty"`
+	EmbeddedObjects []richTextEmbeddedObject `json:"embeddedObjects,omitempty"`
+}
+
+type richTextAttributes struct {
+	Bold          bool          `json:"bold,omitempty"`
+	Italic        bool          `json:"italic,omitempty"`
+	Underline     bool          `json:"underline,omitempty"`
+	Strikethrough bool          `json:"strikethrough,omitempty"`
+	LinkURL       string        `json:"linkURL,omitempty"`
+	Line          *richTextLine `json:"line,omitempty"`
+}
+
+type richTextLine struct {
+	Header int `json:"header,omitempty"`
+}
+
+type richTextEmbeddedObject struct {
+	Type       string `json:"type"`
+	Identifier string `json:"identifier"`
+}
+
+// richTextBuilder accumulates rich text runs while an entry is processed.
+// All methods are no-ops on a nil builder so callers don't need to check whether rich text is enabled.
+type richTextBuilder struct {
+	runs []richTextRun
+}
+
+func (b *richTextBuilder) appendText(text string, attrs richTextAttributes) {
+	if b == nil || text == "" {
+		return
+	}
+	var attrPtr *richTextAttributes
+	if attrs != (richTextAttributes{}) {
+		attrPtr = &attrs
+	}
+	// Merge with the previous run when the formatting is the same
+	if n := len(b.runs); n > 0 && len(b.runs[n-1].EmbeddedObjects) == 0 && attrPtr == nil && b.runs[n-1].Attributes == nil {
+		b.runs[n-1].Text += text
+		return
+	}
+	b.runs = append(b.runs, richTextRun{Text: text, Attributes: attrPtr})
+}
+
+func (b *richTextBuilder) endsWithNewline() bool {
+	if b == nil || len(b.runs) == 0 {
+		return true
+	}
+	last := b.runs[len(b.runs)-1]
+	return len(last.EmbeddedObjects) > 0 || strings.HasSuffix(last.Text, "\n")
+}
+
+// addHeading prepends a heading line, used for the entry title.
+func (b *richTextBuilder) addHeading(text string, level int) {
+	b.prependLine(text, richTextAttributes{Line: &richTextLine{Header: level}})
+}
+
+// prependLine puts a line of text with the given formatting before everything added so far, e.g. the title.
+func (b *richTextBuilder) prependLine(text string, attrs richTextAttributes) {
+	if b == nil || text == "" {
+		return
+	}
+	line := richTextRun{Text: text + "\n", Attributes: &attrs}
+	b.runs = append([]richTextRun{line}, b.runs...)
+}
+
+func (b *richTextBuilder) addPhoto(identifier string) {
+	b.addEmbedded("photo", identifier)
+}
+
+// addGallery adds photos shown side by side: one run holding all of their embedded objects.
+func (b *richTextBuilder) addGallery(identifiers []string) {
+	if b == nil {
+		return
+	}
+	objects := make([]richTextEmbeddedObject, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		objects = append(objects, richTextEmbeddedObject{Type: "photo", Identifier: identifier})
+	}
+	b.runs = append(b.runs, richTextRun{EmbeddedObjects: objects})
+}
+
+// addEmbedded adds an embedded media object ("photo", "video" or "audio").
+func (b *richTextBuilder) addEmbedded(kind string, identifier string) {
+	if b == nil {
+		return
+	}
+	b.runs = append(b.runs, richTextRun{EmbeddedObjects: []richTextEmbeddedObject{{Type: kind, Identifier: identifier}}})
+}
+
+// addFragment converts an HTML fragment to inline runs followed by a paragraph break.
+func (b *richTextBuilder) addFragment(htmlFrag string) {
+	if b == nil {
+		return
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlFrag))
+	if err != nil {
+		return
+	}
+	b.addSelection(doc.Find("body"), richTextAttributes{})
+	if !b.endsWithNewline() {
+		b.appendText("\n", richTextAttributes{})
+	}
+}
+
+func (b *richTextBuilder) addSelection(sel *goquery.Selection, attrs richTextAttributes) {
+	sel.Contents().Each(func(i int, child *goquery.Selection) {
+		childAttrs := attrs
+		switch goquery.NodeName(child) {
+		case "#text":
+			text := strings.Join(strings.Fields(child.Text()), " ")
+			if text == "" {
+				return
+			}
+			// Keep the single space between words that span separate text nodes
+			if raw := child.Text(); strings.TrimLeftFunc(raw, unicode.IsSpace) != raw && !b.endsWithNewline() {
+				text = " " + text
+			}
+			if raw := child.Text(); strings.TrimRightFunc(raw, unicode.IsSpace) != raw {
+				text += " "
+			}
+			b.appendText(text, attrs)
+			return
+		case "br":
+			b.appendText("\n", richTextAttributes{})
+			return
+		case "input":
+			if child.AttrOr("type", "") == "checkbox" {
+				if _, checked := child.Attr("checked"); checked {
+					b.appendText("[x] ", richTextAttributes{})
+				} else {
+					b.appendText("[ ] ", richTextAttributes{})
+				}
+			}
+			return
+		case "b", "strong":
+			childAttrs.Bold = true
+		case "i", "em":
+			childAttrs.Italic = true
+		case "u":
+			childAttrs.Underline = true
+		case "s", "strike", "del":
+			childAttrs.Strikethrough = true
+		case "a":
+			if href, ok := child.Attr("href"); ok {
+				childAttrs.LinkURL = href
+			}
+		}
+		b.addSelection(child, childAttrs)
+		if child.Is("p, div, li, h1, h2, h3, h4, h5, h6") && !b.endsWithNewline() {
+			b.appendText("\n", richTextAttributes{})
+		}
+	})
+}
+
+// stripEmoji removes emoji from the text runs, dropping runs left empty, for -strip-emoji.
+func (b *richTextBuilder) stripEmoji() {
+	if b == nil {
+		return
+	}
+	runs := b.runs[:0]
+	for _, run := range b.runs {
+		if run.Text = stripEmoji(run.Text); run.Text != "" || len(run.EmbeddedObjects) > 0 {
+			runs = append(runs, run)
+		}
+	}
+	b.runs = runs
+}
+
+// String returns the JSON encoded rich text document, or "" if there is no content.
+func (b *richTextBuilder) String() string {
+	if b == nil || len(b.runs) == 0 {
+		return ""
+	}
+	// Trailing paragraph break isn't needed
+	if last := &b.runs[len(b.runs)-1]; len(last.EmbeddedObjects) == 0 {
+		last.Text = strings.TrimRight(last.Text, "\n")
+		if last.Text == "" {
+			b.runs = b.runs[:len(b.runs)-1]
+		}
+	}
+	data, err := json.Marshal(richTextDocument{
+		Contents: b.runs,
+		Meta:     richTextMeta{Version: 1, SmallLinesRemoved: true},
+	})
+	if err != nil {
+		log.Printf("Warning: Marshalling rich text: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// outputOptions controls how the Day One zip is written.
+type outputOptions struct {
+	DayOneFormat  bool            // Match the JSON formatting of Day One's own exporter
+	PreserveMtime bool            // Timestamp zip entries from the entries' dates and the media files' mtimes
+	SelfCheck     bool            // Reopen the written zip and verify Journal.json and the referenced media
+	JSONLines     bool            // Write the entries to Journal.jsonl, one entry per line, instead of Journal.json
+	StoredKinds   map[string]bool // zipContentKinds written without compression (-store), the rest is deflated
+	JournalName   string          // Name of the journal file without extension, which Day One names the imported journal after ("" for Journal)
+
+	SanitizeFilenames   bool   // Markdown filenames keep the title's letters in any script, within FilenameMaxLength
+	FilenameReplacement string // Replaces characters dropped from titles in sanitized filenames
+	FilenameMaxLength   int    // Maximum sanitized filename length in bytes, including the date and .md
+}
+
+// defaultStarSelector matches the markers used for bookmarked entries in Apple Journal exports.
+const defaultStarSelector = ".bookmarked, .bookmark, .starred, [data-bookmarked=true]"
+
+// defaultSuggestedSelector matches markers of entries started from a Journaling Suggestion, and the
+// asset types (workouts, places, music) that mostly come from suggestions rather than the user.
+const defaultSuggestedSelector = ".suggestion, .suggestedEntry, .journalingSuggestion, [data-suggestion], " +
+	".assetType_workout, .assetType_activity, .assetType_location, .assetType_music, .assetType_podcast"
+
+// suggestedMaxWords is how many words the user may have added to a suggestion for it to still
+// count as suggested; with more, the entry counts as the user's own writing.
+const suggestedMaxWords = 20
+
+// Values of -suggested
+const (
+	suggestedInclude = "include"
+	suggestedExclude = "exclude"
+	suggestedOnly    = "only"
+)
+
+// defaultRevisionSelector matches blocks holding an earlier version of an edited entry's text.
+const defaultRevisionSelector = ".previousVersion, .entryRevision, .editHistory, [data-revision]"
+
+// Values of -edit-history
+const (
+	editHistoryLatest = "latest"
+	editHistoryAppend = "append"
+	editHistoryField  = "field"
+)
+
+// defaultPinSelector matches pinned markers, for exports that track pinning separately from bookmarks.
+const defaultPinSelector = ".pinned, [data-pinned=true]"
+
 // --- Global Markdown Converter ---
 var markdownConverter *md.Converter
 
 func init() {
 	markdownConverter = md.NewConverter("", true, nil)
+	markdownConverter.Use(plugin.TaskListItems())
+	// The default rule turns <br> into a paragraph break; keep it a single line break so single-spaced
+	// lines stay single-spaced, while separate <p> elements still become paragraphs
+	markdownConverter.AddRules(md.Rule{
+		Filter: []string{"br"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			return md.String("\n")
+		},
+	})
+	markdownConverter.Before(markBlockStartMarkers)
+}
+
+// blockStartEscape marks a character markBlockStartMarkers wants escaped; unescapeInlineMarkers turns
+// it into a backslash where the character starts a line and drops it elsewhere. It is a private-use
+// rune, so journal text doesn't contain it and the converter leaves it alone.
+const blockStartEscape = "\uE002"
+
+// blockStartMarkerRegex matches text that starts a quote, heading or list at the start of a line.
+// The submatch is the character to escape.
+var blockStartMarkerRegex = regexp.MustCompile(`^(?:(>)|(#)#{0,5}(?:[ \t]|$)|([-+*])[ \t]|[0-9]{1,9}(\.)[ \t])`)
+
+// markBlockStartMarkers puts blockStartEscape before a quote, heading or list marker that starts the
+// text of a block. The converter only escapes these at the very start of a text node and then trims the
+// block, so "&nbsp;&gt;&nbsp;^&nbsp;&lt;" (ASCII art) would come out as a quote.
+func markBlockStartMarkers(selec *goquery.Selection) {
+	selec.Find("p, div, li, blockquote, h1, h2, h3, h4, h5, h6, td, th").Each(func(i int, block *goquery.Selection) {
+		text, _ := firstTextNode(block)
+		if text == nil {
+			return
+		}
+		node := text.Nodes[0]
+		indent := len(node.Data) - len(strings.TrimLeftFunc(node.Data, unicode.IsSpace))
+		if m := blockStartMarkerRegex.FindStringSubmatchIndex(node.Data[indent:]); m != nil {
+			for g := 2; g < len(m); g += 2 {
+				if m[g] >= 0 {
+					at := indent + m[g]
+					node.Data = node.Data[:at] + blockStartEscape + node.Data[at:]
+					break
+				}
+			}
+		}
+	})
+}
+
+// firstTextNode returns the first text node with more than whitespace in s, or nil if there is none
+// or the text starts after code or an image, which keep anything after them off the line start.
+// stop reports that the search ended at such an element.
+func firstTextNode(s *goquery.Selection) (text *goquery.Selection, stop bool) {
+	s.Contents().EachWithBreak(func(i int, c *goquery.Selection) bool {
+		switch {
+		case goquery.NodeName(c) == "#text":
+			if strings.TrimSpace(c.Text()) != "" {
+				text = c
+			}
+		case c.Is("code, pre, img, input"):
+			stop = true
+		case c.Is("br"):
+		default:
+			text, stop = firstTextNode(c)
+		}
+		return text == nil && !stop
+	})
+	return text, stop
+}
+
+// convertToMarkdown converts an HTML fragment with markdownConverter and drops the escapes it adds by mistake.
+func convertToMarkdown(htmlFrag string) (string, error) {
+	markdown, err := markdownConverter.ConvertString(htmlFrag)
+	if err != nil {
+		return "", err
+	}
+	return unescapeInlineMarkers(markdown), nil
+}
+
+// fragmentToMarkdown converts the entry body's fragments. It is convertToMarkdown; tests swap in a
+// failing converter to exercise the plain-text fallback.
+var fragmentToMarkdown = convertToMarkdown
+
+// flattenParagraph and flattenLineBreak mark block and <br> boundaries in the text flattenToMarkdown
+// extracts. They are private-use runes, so journal text doesn't contain them.
+const (
+	flattenParagraph = "\uE000"
+	flattenLineBreak = "\uE001"
+)
+
+// flattenToMarkdown is the -flatten-markdown alternative to convertToMarkdown: it takes the fragment's
+// text and writes only paragraphs, line breaks, list items, headings and links as markdown. Bold,
+// italics, quotes, tables and code are plain text, and text that looks like markdown isn't escaped.
+func flattenToMarkdown(htmlFrag string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlFrag))
+	if err != nil {
+		return ""
+	}
+	doc.Find("br").ReplaceWithHtml(flattenLineBreak)
+	doc.Find("a[href]").Each(func(i int, a *goquery.Selection) {
+		text := strings.Join(strings.Fields(a.Text()), " ")
+		if href := a.AttrOr("href", ""); text != "" && text != href {
+			a.SetText("[" + text + "](" + href + ")")
+		}
+	})
+	doc.Find("li").Each(func(i int, li *goquery.Selection) {
+		marker := "- "
+		if li.Parent().Is("ol") {
+			marker = strconv.Itoa(li.Index()+1) + ". "
+		}
+		if checkbox := li.Find("input[type=checkbox]").First(); checkbox.Length() > 0 {
+			marker = "- [ ] "
+			if _, checked := checkbox.Attr("checked"); checked {
+				marker = "- [x] "
+			}
+		}
+		li.PrependHtml(flattenLineBreak + html.EscapeString(marker))
+	})
+	doc.Find("h1, h2, h3, h4, h5, h6").Each(func(i int, heading *goquery.Selection) {
+		level := int(goquery.NodeName(heading)[1] - '0')
+		heading.PrependHtml(flattenParagraph + strings.Repeat("#", level) + " ")
+	})
+	doc.Find("p, div, blockquote, ul, ol, h1, h2, h3, h4, h5, h6").Each(func(i int, block *goquery.Selection) {
+		block.PrependHtml(flattenParagraph)
+		block.AppendHtml(flattenParagraph)
+	})
+
+	// Whitespace in the HTML source is collapsed like a browser would, only the markers break lines
+	text := strings.Join(strings.Fields(doc.Text()), " ")
+	var blocks []string
+	for _, block := range strings.Split(text, flattenParagraph) {
+		var lines []string
+		for _, line := range strings.Split(block, flattenLineBreak) {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			blocks = append(blocks, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// unescapeInlineMarkers removes the backslash the converter puts before -, +, ., # and > where it
+// takes them for the start of a line. It escapes each text node on its own, so text in a nested
+// <span> mid-line comes out as "Then \- a walk". Escapes that really start a line ("\- item",
+// "2025\. A year"), escaped backslashes, code spans and fenced code are left alone. A blockStartEscape
+// becomes such an escape where it starts a line, and is dropped elsewhere.
+func unescapeInlineMarkers(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			lines[i] = strings.ReplaceAll(line, blockStartEscape, "")
+			continue
+		}
+		if !strings.Contains(line, `\`) && !strings.Contains(line, blockStartEscape) {
+			continue
+		}
+		var b strings.Builder
+		inCode := false
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+			if strings.HasPrefix(line[j:], blockStartEscape) {
+				j += len(blockStartEscape) - 1
+				if next := line[j+1:]; !inCode && next != "" && next[0] != '\\' && escapesLineStart(b.String(), next[0]) {
+					b.WriteByte('\\')
+				}
+				continue
+			}
+			if c == '`' {
+				inCode = !inCode
+			} else if c == '\\' && !inCode && j+1 < len(line) {
+				next := line[j+1]
+				if strings.IndexByte("-+.#>", next) >= 0 && !escapesLineStart(line[:j], next) {
+					continue // Drop the backslash, keep the character
+				}
+				b.WriteString(line[j : j+2]) // Keep the escape, including "\\"
+				j++
+				continue
+			}
+			b.WriteByte(c)
+		}
+		lines[i] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapesLineStart reports whether an escaped marker preceded by prefix on its line would otherwise start
+// a list, heading or quote: nothing but whitespace and other markers before it, or for "." only a number.
+func escapesLineStart(prefix string, marker byte) bool {
+	if marker == '.' {
+		number := strings.TrimRight(prefix, "0123456789")
+		if number == prefix {
+			return false
+		}
+		prefix = number
+	}
+	return strings.IndexFunc(prefix, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0
 }
 
 // --- Helper Functions ---
 
+// newUUID generates the UUIDs behind every entry and media identifier. It defaults to random
+// UUIDs; the golden tests swap in a sequential generator. uuid.New is safe for concurrent use, and any
+// replacement must be too.
+var newUUID = uuid.New
+
+// timeNow is the clock behind request signing and progress logging; tests pin it.
+var timeNow = time.Now
+
+// newDayOneUUID returns a UUID in Day One's format: 32 uppercase hex digits without dashes.
 func newDayOneUUID() string {
-	return strings.ReplaceAll(strings.ToUpper(uuid.New().String()), "-", "")
+	return strings.ReplaceAll(strings.ToUpper(newUUID().String()), "-", "")
 }
 
 func calculateMD5(filePath string) (string, error) {
@@ -84,16 +807,18 @@ func unzip(src, dest string) error {
 		return err
 	}
 
-
 	for _, f := range r.File {
-		fpath := filepath.Join(dest, f.Name)
+		// Zips created on Windows may use backslashes as separators, normalize them
+		// to forward slashes before converting to the OS separator
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		fpath := filepath.Join(dest, filepath.FromSlash(name))
 
 		// Check for ZipSlip vulnerability
 		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
 			return fmt.Errorf("%s: illegal file path", fpath)
 		}
 
-		if f.FileInfo().IsDir() {
+		if f.FileInfo().IsDir() || strings.HasSuffix(name, "/") {
 			os.MkdirAll(fpath, os.ModePerm)
 			continue
 		}
@@ -122,286 +847,4277 @@ func unzip(src, dest string) error {
 		if err != nil {
 			return err
 		}
+
+		// Keep the archived modification time so it can be carried into the output (-preserve-mtime)
+		if !f.Modified.IsZero() {
+			if err := os.Chtimes(fpath, f.Modified, f.Modified); err != nil {
+				log.Printf("Warning: Failed to set modification time of %s: %v", fpath, err)
+			}
+		}
 	}
 	return nil
 }
 
-// parseAppleDate parses dates like "Wednesday, May 14, 2025" or "Tuesday, December 12, 2023"
-func parseAppleDate(dateStr string) (time.Time, error) {
-	// Normalize by removing the day of the week part
-	parts := strings.SplitN(dateStr, ",", 2)
-	if len(parts) == 2 {
-		dateStr = strings.TrimSpace(parts[1]) // "May 14, 2025" or "December 12, 2023"
+func isRemoteURL(src string) bool {
+	lower := strings.ToLower(src)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// fetchRemoteImage downloads an image into destDir and returns the local path.
+// The extension is taken from the URL path, or from the response Content-Type when the URL has none.
+func fetchRemoteImage(imageURL string, destDir string, timeout time.Duration) (string, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected HTTP status %s", resp.Status)
 	}
 
-	// Try parsing "January 2, 2006" format
-	layouts := []string{
-		"January 2, 2006", // For "May 14, 2025"
-		"Jan 2, 2006",     // Just in case
+	fileExt := ""
+	if parsed, err := url.Parse(imageURL); err == nil {
+		fileExt = strings.ToLower(path.Ext(parsed.Path))
 	}
-	var t time.Time
-	var err error
-	for _, layout := range layouts {
-		t, err = time.Parse(layout, dateStr)
-		if err == nil {
-			// Set time to noon UTC for consistency, as Apple Journal HTML doesn't provide time
-			t = time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.UTC)
-			return t, nil
+	if fileExt == "" {
+		if exts, err := mime.ExtensionsByType(resp.Header.Get("Content-Type")); err == nil && len(exts) > 0 {
+			fileExt = exts[0]
 		}
 	}
-	return time.Time{}, fmt.Errorf("failed to parse date string '%s' with known layouts: %w", dateStr, err)
-}
 
-
-func processEntryHTML(htmlFilePath string, baseResourcesPath string, defaultTimeZone string) (DayOneEntry, map[string]string, error) {
-	file, err := os.Open(htmlFilePath)
-	if err != nil {
-		return DayOneEntry{}, nil, fmt.Errorf("opening HTML file %s: %w", htmlFilePath, err)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", err
 	}
-	defer file.Close()
-
-	doc, err := goquery.NewDocumentFromReader(file)
+	localPath := filepath.Join(destDir, newDayOneUUID()+fileExt)
+	outFile, err := os.Create(localPath)
 	if err != nil {
-		return DayOneEntry{}, nil, fmt.Errorf("parsing HTML file %s: %w", htmlFilePath, err)
+		return "", err
 	}
-
-	entry := DayOneEntry{
-		UUID:    newDayOneUUID(),
-		Starred: false, // Default
-		TimeZone: defaultTimeZone,
-		Photos:  make([]DayOnePhoto, 0),
+	defer outFile.Close()
+	if _, err := io.Copy(outFile, resp.Body); err != nil {
+		return "", err
 	}
-	mediaToCopy := make(map[string]string) // originalPath -> dayOneZipPath
+	return localPath, nil
+}
 
-	// --- Extract Date ---
-	dateStr := strings.TrimSpace(doc.Find("div.pageHeader").First().Text())
-	if dateStr == "" {
-		log.Printf("Warning: No date found in pageHeader for %s. Skipping entry.", htmlFilePath)
-		return DayOneEntry{}, nil, fmt.Errorf("no date found in pageHeader for %s", htmlFilePath)
+// imageSource returns the path of an image: its src, or for lazy-loaded and responsive markup its
+// data-src or the first srcset candidate. A data: URI in src is taken as a lazy-loading placeholder.
+func imageSource(imgSel *goquery.Selection) string {
+	src := strings.TrimSpace(imgSel.AttrOr("src", ""))
+	if src != "" && !strings.HasPrefix(strings.ToLower(src), "data:") {
+		return src
 	}
-	creationTime, err := parseAppleDate(dateStr)
-	if err != nil {
-		log.Printf("Warning: Could not parse date '%s' for %s: %v. Skipping entry.", dateStr, htmlFilePath, err)
-		return DayOneEntry{}, nil, fmt.Errorf("could not parse date '%s' for %s: %w",dateStr, htmlFilePath, err)
+	if dataSrc := strings.TrimSpace(imgSel.AttrOr("data-src", "")); dataSrc != "" {
+		return dataSrc
 	}
-	isoDate := creationTime.Format(time.RFC3339) // "2006-01-02T15:04:05Z07:00"
-	entry.CreationDate = isoDate
-	entry.ModifiedDate = isoDate // Default modified to creation
+	// srcset is "path 1x, path@2x 2x" or "path 640w, ..."; the first candidate is usually the original
+	if candidate := strings.Fields(strings.Split(imgSel.AttrOr("srcset", ""), ",")[0]); len(candidate) > 0 {
+		return candidate[0]
+	}
+	return src
+}
 
-	// --- Extract Title ---
-	var entryTitle string
-	titleSelection := doc.Find("div.title span.s2").First() // As seen in 2025-05-14 sample
-	if titleSelection.Length() > 0 {
-		entryTitle = strings.TrimSpace(titleSelection.Text())
-	} else {
-		// Fallback to filename if it contains a title part
+var emojiCodepointFilename = regexp.MustCompile(`^(?i)(?:emoji[_-])?([0-9a-f]{4,6}(?:[-_][0-9a-f]{4,6})*)$`)
+
+// emojiFromImage returns the Unicode emoji an <img> stands for, or "" if it's a regular image.
+// Emoji images are recognised by an emoji-only alt/aria-label, or by an "emoji" class with a
+// codepoint filename such as 1f600.png or 1f44d-1f3fd.png.
+func emojiFromImage(imgSel *goquery.Selection) string {
+	for _, attr := range []string{"alt", "aria-label", "data-emoji"} {
+		if text, ok := imgSel.Attr(attr); ok && isEmojiText(strings.TrimSpace(text)) {
+			return strings.TrimSpace(text)
+		}
+	}
+	class, _ := imgSel.Attr("class")
+	if !strings.Contains(strings.ToLower(class), "emoji") {
+		return ""
+	}
+	src := imageSource(imgSel)
+	base := path.Base(src)
+	match := emojiCodepointFilename.FindStringSubmatch(strings.TrimSuffix(base, path.Ext(base)))
+	if match == nil {
+		return ""
+	}
+	var emoji strings.Builder
+	for _, hex := range strings.FieldsFunc(match[1], func(r rune) bool { return r == '-' || r == '_' }) {
+		cp, err := strconv.ParseInt(hex, 16, 32)
+		if err != nil {
+			return ""
+		}
+		emoji.WriteRune(rune(cp))
+	}
+	return emoji.String()
+}
+
+// isEmojiText reports whether text is a short run of emoji (including ZWJ sequences,
+// variation selectors, skin tone modifiers and flags).
+func isEmojiText(text string) bool {
+	if text == "" || utf8.RuneCountInString(text) > 16 {
+		return false
+	}
+	hasSymbol := false
+	for _, r := range text {
+		switch {
+		case r == 0x200D || (r >= 0xFE00 && r <= 0xFE0F) || (r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F):
+			// joiners, variation selectors, skin tones and tag characters
+		case unicode.Is(unicode.So, r) || (r >= 0x1F1E6 && r <= 0x1F1FF):
+			hasSymbol = true
+		default:
+			return false
+		}
+	}
+	return hasSymbol
+}
+
+// emojiPresentation holds the characters shown as emoji by default (Unicode's Emoji_Presentation property,
+// with the pictograph blocks taken whole). Symbols such as ❤ or © are only emoji when followed by U+FE0F.
+var emojiPresentation = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x231A, 0x231B, 1}, {0x23E9, 0x23EC, 1}, {0x23F0, 0x23F0, 1}, {0x23F3, 0x23F3, 1}, {0x25FD, 0x25FE, 1},
+		{0x2614, 0x2615, 1}, {0x2648, 0x2653, 1}, {0x267F, 0x267F, 1}, {0x2693, 0x2693, 1}, {0x26A1, 0x26A1, 1},
+		{0x26AA, 0x26AB, 1}, {0x26BD, 0x26BE, 1}, {0x26C4, 0x26C5, 1}, {0x26CE, 0x26CE, 1}, {0x26D4, 0x26D4, 1},
+		{0x26EA, 0x26EA, 1}, {0x26F2, 0x26F3, 1}, {0x26F5, 0x26F5, 1}, {0x26FA, 0x26FA, 1}, {0x26FD, 0x26FD, 1},
+		{0x2705, 0x2705, 1}, {0x270A, 0x270B, 1}, {0x2728, 0x2728, 1}, {0x274C, 0x274C, 1}, {0x274E, 0x274E, 1},
+		{0x2753, 0x2755, 1}, {0x2757, 0x2757, 1}, {0x2795, 0x2797, 1}, {0x27B0, 0x27B0, 1}, {0x27BF, 0x27BF, 1},
+		{0x2B1B, 0x2B1C, 1}, {0x2B50, 0x2B50, 1}, {0x2B55, 0x2B55, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1F004, 0x1F004, 1}, {0x1F0CF, 0x1F0CF, 1}, {0x1F18E, 0x1F18E, 1}, {0x1F191, 0x1F19A, 1},
+		{0x1F1E6, 0x1F1FF, 1}, {0x1F201, 0x1F251, 1}, {0x1F300, 0x1F64F, 1}, {0x1F680, 0x1F6FF, 1},
+		{0x1F7E0, 0x1F7FF, 1}, {0x1F900, 0x1F9FF, 1}, {0x1FA70, 0x1FAFF, 1},
+	},
+}
+
+// emojiModifier reports whether r continues an emoji: variation selectors, the keycap mark,
+// skin tones and the tag characters of subdivision flags.
+func emojiModifier(r rune) bool {
+	return (r >= 0xFE00 && r <= 0xFE0F) || r == 0x20E3 || (r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F)
+}
+
+// emojiLength returns how many runes the emoji starting at runes[i] spans, including modifiers, flag pairs
+// and ZWJ sequences (👨‍👩‍👧, 👍🏽, 🇯🇵, 1️⃣, ❤️), or 0 if no emoji starts there.
+func emojiLength(runes []rune, i int) int {
+	next := func(j int) rune {
+		if j < len(runes) {
+			return runes[j]
+		}
+		return 0
+	}
+	r := runes[i]
+	switch {
+	case unicode.Is(emojiPresentation, r):
+	case strings.ContainsRune("0123456789#*", r):
+		// Keycaps: a digit, # or * with the keycap mark
+		if next(i+1) != 0x20E3 && !(next(i+1) == 0xFE0F && next(i+2) == 0x20E3) {
+			return 0
+		}
+	case next(i+1) == 0xFE0F && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r):
+		// A text symbol with emoji presentation requested
+	default:
+		return 0
+	}
+	j := i + 1
+	if r >= 0x1F1E6 && r <= 0x1F1FF && next(j) >= 0x1F1E6 && next(j) <= 0x1F1FF {
+		j++ // Second regional indicator of a flag
+	}
+	for j < len(runes) {
+		switch {
+		case emojiModifier(runes[j]):
+			j++
+		case runes[j] == 0x200D && j+1 < len(runes):
+			j += 2 // Zero width joiner and the emoji it joins
+		default:
+			return j - i
+		}
+	}
+	return j - i
+}
+
+// stripEmoji removes emoji from text, for -strip-emoji, without leaving doubled spaces or spaces at
+// the start or end of a line behind.
+func stripEmoji(text string) string {
+	runes := []rune(text)
+	out := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); {
+		n := emojiLength(runes, i)
+		if n == 0 {
+			out = append(out, runes[i])
+			i++
+			continue
+		}
+		i += n
+		lineStart := len(out) == 0 || out[len(out)-1] == '\n'
+		lineEnd := i == len(runes) || runes[i] == '\n'
+		switch {
+		case lineStart && i < len(runes) && runes[i] == ' ':
+			i++ // "🎉 Party" becomes "Party"
+		case !lineStart && out[len(out)-1] == ' ' && (lineEnd || runes[i] == ' '):
+			out = out[:len(out)-1] // "a 🎉 b" becomes "a b", "a 🎉" becomes "a"
+		}
+	}
+	return string(out)
+}
+
+// defaultTitleFormat is the -title-format default: the title as a level 1 heading.
+const defaultTitleFormat = "# {{.Title}}"
+
+// titleFormatData is what -title-format templates are executed with.
+type titleFormatData struct {
+	Title string
+}
+
+// parseTitleFormat parses a -title-format template and checks, with a sample title, that it executes
+// and includes the title.
+func parseTitleFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("title-format").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	var sample strings.Builder
+	if err := tmpl.Execute(&sample, titleFormatData{Title: "Sample Title"}); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(sample.String(), "Sample Title") {
+		return nil, errors.New("the format doesn't include {{.Title}}")
+	}
+	return tmpl, nil
+}
+
+// renderTitle formats a title to inject above the text with the -title-format template (a "# " heading if nil).
+func renderTitle(tmpl *template.Template, title string) string {
+	if tmpl == nil {
+		return "# " + title
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, titleFormatData{Title: title}); err != nil {
+		log.Printf("Warning: -title-format failed for title '%s': %v. Using a heading instead.", title, err)
+		return "# " + title
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// maxTitleLength caps titles that are really the first sentence of the body.
+const maxTitleLength = 100
+
+// normalizeTitle collapses internal whitespace, strips wrapping quotes and trailing punctuation
+// and truncates overly long titles with an ellipsis.
+func normalizeTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	title = strings.Trim(title, "\"'“”‘’«»")
+	title = strings.TrimRight(title, ".,;:-–— ")
+	title = strings.TrimSpace(strings.Trim(title, "\"'“”‘’«»"))
+
+	runes := []rune(title)
+	if len(runes) > maxTitleLength {
+		cut := string(runes[:maxTitleLength])
+		// Prefer cutting at a word boundary
+		if i := strings.LastIndex(cut, " "); i > maxTitleLength/2 {
+			cut = cut[:i]
+		}
+		title = strings.TrimRight(cut, ".,;:-–— ") + "…"
+	}
+	return title
+}
+
+// ordinalSuffixRegex matches a day number with an ordinal suffix, like the "14th" of "May 14th, 2025".
+var ordinalSuffixRegex = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)\b`)
+
+// parseAppleDate parses dates like "Wednesday, May 14, 2025" or "Tuesday, December 12, 2023".
+// Ordinal days ("May 14th, 2025") are accepted. extraLayouts (from -date-layout) are tried after the built-in layouts.
+func parseAppleDate(dateStr string, extraLayouts []string) (time.Time, error) {
+	// time.Parse has no ordinal days, some export variants write them
+	dateStr = ordinalSuffixRegex.ReplaceAllString(dateStr, "$1")
+	// Normalize by removing the day of the week part
+	candidates := []string{strings.TrimSpace(dateStr)}
+	parts := strings.SplitN(dateStr, ",", 2)
+	if len(parts) == 2 {
+		dateStr = strings.TrimSpace(parts[1]) // "May 14, 2025" or "December 12, 2023"
+		// Headers without a weekday ("May 14, 2025") are tried as-is afterwards
+		candidates = append([]string{dateStr}, candidates...)
+	}
+
+	// Try parsing "January 2, 2006" format
+	layouts := []string{
+		"January 2, 2006", // For "May 14, 2025"
+		"Jan 2, 2006",     // Just in case
+	}
+	layouts = append(layouts, extraLayouts...)
+	var t time.Time
+	var err error
+	for _, candidate := range candidates {
+		for _, layout := range layouts {
+			t, err = time.Parse(layout, candidate)
+			if err == nil {
+				// Set time to noon UTC for consistency, as Apple Journal HTML doesn't provide time
+				t = time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.UTC)
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to parse date string '%s' with known layouts: %w", dateStr, err)
+}
+
+// dateLayoutReference is formatted and parsed back with each -date-layout to validate it.
+// Day and month differ so a layout that swaps them is caught.
+var dateLayoutReference = time.Date(2025, time.May, 14, 12, 0, 0, 0, time.UTC)
+
+// validateDateLayout checks that a Go time layout parses back the full date (year, month and day) it formats.
+func validateDateLayout(layout string) error {
+	formatted := dateLayoutReference.Format(layout)
+	t, err := time.Parse(layout, formatted)
+	if err != nil {
+		return err
+	}
+	if t.Year() != dateLayoutReference.Year() || t.YearDay() != dateLayoutReference.YearDay() {
+		return fmt.Errorf("the layout doesn't capture a full date: '%s' parses back as %s", formatted, t.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// articleHeaderParts splits the <header> of the <article> export layout into its date and title parts.
+// The title is the first heading; the date is a <time> element if present, otherwise the remaining header text.
+func articleHeaderParts(article *goquery.Selection) (dateSel *goquery.Selection, titleSel *goquery.Selection) {
+	header := article.Find("header").First()
+	titleSel = header.Find("h1, h2, h3").First()
+	dateSel = header.Find("time").First()
+	if dateSel.Length() == 0 {
+		dateSel = header.Clone()
+		dateSel.Find("h1, h2, h3, h4, h5, h6").Remove()
+	}
+	return dateSel, titleSel
+}
+
+// timeZoneAbbreviations maps timezone abbreviations found in export headers to Olson names.
+// Abbreviations are ambiguous, the mapping favours the most common (mostly US) meaning:
+// CST is US Central (not China), IST is India (not Ireland/Israel), BST is British Summer Time.
+var timeZoneAbbreviations = map[string]string{
+	"UTC": "UTC", "GMT": "UTC",
+	"EST": "America/New_York", "EDT": "America/New_York",
+	"CST": "America/Chicago", "CDT": "America/Chicago",
+	"MST": "America/Denver", "MDT": "America/Denver",
+	"PST": "America/Los_Angeles", "PDT": "America/Los_Angeles",
+	"AKST": "America/Anchorage", "AKDT": "America/Anchorage",
+	"HST": "Pacific/Honolulu",
+	"BST": "Europe/London",
+	"CET": "Europe/Paris", "CEST": "Europe/Paris",
+	"EET": "Europe/Athens", "EEST": "Europe/Athens",
+	"IST":  "Asia/Kolkata",
+	"JST":  "Asia/Tokyo",
+	"AEST": "Australia/Sydney", "AEDT": "Australia/Sydney",
+}
+
+// headerDateRegex finds the date, and the time that may follow it, in header text holding more than the
+// date, e.g. "Wednesday, May 14, 2025 · Morning" or "Evening May 14, 2025 at 9:10 PM".
+var headerDateRegex = regexp.MustCompile(`(?i)(?:\b(?:mon|tues|wednes|thurs|fri|satur|sun)day,\s*)?\b(?:jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:tember)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\s+\d{1,2}(?:st|nd|rd|th)?,\s*\d{4}\b(?:\s+at\s+\d{1,2}:\d{2}(?:\s*[AP]M)?(?:\s+(?:(?-i:[A-Z]{2,5})\b|(?:UTC|GMT)?[+-]\d{1,2}(?::?\d{2})?))?)?`)
+
+// headerDateText returns the date of a pageHeader's text with whitespace collapsed. When the header also
+// holds a subtitle or day-part label, only the "Month D, YYYY" date and its time are kept; headers without
+// such a date are returned whole, so -date-layout formats still see all of it.
+func headerDateText(header string) string {
+	header = strings.Join(strings.Fields(header), " ")
+	if match := headerDateRegex.FindString(header); match != "" {
+		return match
+	}
+	return header
+}
+
+// headerTimeRegex matches the optional " at 2:47 PM EDT" / " at 14:47 +02:00" suffix of a header date.
+var headerTimeRegex = regexp.MustCompile(`(?i)^(.*?)\s+at\s+(\d{1,2}:\d{2}(?:\s*[AP]M)?)(?:\s+([A-Z]{2,5}|(?:UTC|GMT)?[+-]\d{1,2}(?::?\d{2})?))?$`)
+
+// parseAppleDateTime parses a header date that may carry a time of day and timezone,
+// e.g. "Wednesday, May 14, 2025 at 2:47 PM EDT". It returns the time and the Olson timezone
+// derived from the header ("" if the header has no timezone). A time without a timezone is taken
+// to be in defaultLoc. Headers without a time fall back to parseAppleDate's noon UTC.
+func parseAppleDateTime(dateStr string, defaultLoc *time.Location, extraLayouts []string) (time.Time, string, error) {
+	match := headerTimeRegex.FindStringSubmatch(strings.TrimSpace(dateStr))
+	if match == nil {
+		t, err := parseAppleDate(dateStr, extraLayouts)
+		return t, "", err
+	}
+	day, err := parseAppleDate(match[1], extraLayouts)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	clockStr := strings.ToUpper(strings.Join(strings.Fields(match[2]), " "))
+	var clock time.Time
+	for _, layout := range []string{"3:04 PM", "3:04PM", "15:04"} {
+		if clock, err = time.Parse(layout, clockStr); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("failed to parse time '%s': %w", match[2], err)
+	}
+
+	loc := defaultLoc
+	timeZone := ""
+	if zone := strings.ToUpper(match[3]); zone != "" {
+		if olson, ok := timeZoneAbbreviations[zone]; ok {
+			if l, err := time.LoadLocation(olson); err == nil {
+				loc, timeZone = l, olson
+			} else {
+				log.Printf("Warning: Could not load timezone %s for '%s': %v. Using the default timezone.", olson, zone, err)
+			}
+		} else if offset, ok := parseUTCOffset(zone); ok {
+			loc = time.FixedZone(zone, offset)
+			timeZone = offsetTimeZone(offset)
+		} else {
+			log.Printf("Warning: Unknown timezone '%s' in date '%s'. Using the default timezone.", zone, dateStr)
+		}
+	}
+	t := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	return t, timeZone, nil
+}
+
+// offsetTimeZone returns the Olson name of a UTC offset in seconds east of UTC, or "" if it isn't whole hours.
+func offsetTimeZone(offset int) string {
+	if offset == 0 {
+		return "UTC"
+	}
+	if offset%3600 != 0 {
+		return ""
+	}
+	// Etc/GMT zones have inverted signs: UTC+2 is Etc/GMT-2
+	return fmt.Sprintf("Etc/GMT%+d", -offset/3600)
+}
+
+// timeElementDatetime returns the datetime attribute of the entry's <time> element, in (or being) the header
+// or a direct child of the page container; <time>s of embedded entries further down aren't the entry's date.
+func timeElementDatetime(pageHeader, pageContainer *goquery.Selection) string {
+	timeSel := pageHeader.Filter("time[datetime]").AddSelection(pageHeader.Find("time[datetime]")).AddSelection(pageContainer.ChildrenFiltered("time[datetime]")).First()
+	return strings.TrimSpace(timeSel.AttrOr("datetime", ""))
+}
+
+// parseDatetimeAttribute parses the datetime attribute of a <time> element: a date ("2025-05-14") or a date and
+// time with an optional offset ("2025-05-14T14:47:00-04:00", "2025-05-14 14:47Z"). It returns the time, the Olson
+// timezone of the offset ("" without one) and whether there is a time of day. A time without an offset is in
+// defaultLoc, a date alone is noon UTC like parseAppleDate.
+func parseDatetimeAttribute(value string, defaultLoc *time.Location) (time.Time, string, bool, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.UTC), "", false, nil
+	}
+	dateTime := strings.Replace(value, " ", "T", 1) // A space may separate the date and time
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05Z0700", "2006-01-02T15:04Z0700"} {
+		if t, err := time.Parse(layout, dateTime); err == nil {
+			_, offset := t.Zone()
+			return t, offsetTimeZone(offset), true, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, dateTime, defaultLoc); err == nil {
+			return t, "", true, nil
+		}
+	}
+	return time.Time{}, "", false, fmt.Errorf("'%s' is not a date or a date and time", value)
+}
+
+// parseUTCOffset parses offsets like "+02:00", "-0400", "UTC+2" or "GMT-5:30" into seconds east of UTC.
+func parseUTCOffset(zone string) (int, bool) {
+	zone = strings.TrimPrefix(strings.TrimPrefix(zone, "UTC"), "GMT")
+	if len(zone) < 2 || (zone[0] != '+' && zone[0] != '-') {
+		return 0, false
+	}
+	sign := 1
+	if zone[0] == '-' {
+		sign = -1
+	}
+	digits := strings.ReplaceAll(zone[1:], ":", "")
+	var hours, minutes int
+	switch len(digits) {
+	case 1, 2:
+		hours, _ = strconv.Atoi(digits)
+	case 3, 4:
+		hours, _ = strconv.Atoi(digits[:len(digits)-2])
+		minutes, _ = strconv.Atoi(digits[len(digits)-2:])
+	default:
+		return 0, false
+	}
+	return sign * (hours*3600 + minutes*60), true
+}
+
+// timeZoneMap assigns Olson timezones to individual entries, keyed by lowercase HTML filename
+// ("2025-05-14_trip.html") or by entry date ("2025-05-14"). See loadTimeZoneMap.
+type timeZoneMap map[string]string
+
+// loadTimeZoneMap reads a -tz-per-entry-file mapping: a JSON object of key -> timezone for .json
+// files, otherwise CSV lines "key,timezone" (blank lines, # comments and a "file,timezone" style header are skipped).
+// Every timezone is loaded once so that typos are reported before converting.
+func loadTimeZoneMap(path string) (timeZoneMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]string)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	} else {
+		r := csv.NewReader(bytes.NewReader(data))
+		r.Comment = '#'
+		r.FieldsPerRecord = 2
+		r.TrimLeadingSpace = true
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		for i, record := range records {
+			key, zone := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+			if i == 0 && strings.EqualFold(zone, "timezone") {
+				continue // Header row
+			}
+			raw[key] = zone
+		}
+	}
+
+	m := make(timeZoneMap, len(raw))
+	for key, zone := range raw {
+		if key == "" || zone == "" {
+			return nil, fmt.Errorf("empty filename/date or timezone in mapping '%s' -> '%s'", key, zone)
+		}
+		if _, err := time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("invalid timezone '%s' for '%s': %w", zone, key, err)
+		}
+		m[strings.ToLower(filepath.Base(key))] = zone
+	}
+	return m, nil
+}
+
+// zoneFor returns the mapped timezone of an entry ("" if unmapped). A filename mapping takes
+// precedence over a date mapping; the date comes from the header, else the filename's date prefix.
+func (m timeZoneMap) zoneFor(htmlFilePath, dateStr string, extraLayouts []string) string {
+	if len(m) == 0 {
+		return ""
+	}
+	if zone, ok := m[strings.ToLower(filepath.Base(htmlFilePath))]; ok {
+		return zone
+	}
+	dayStr := strings.TrimSpace(dateStr)
+	if match := headerTimeRegex.FindStringSubmatch(dayStr); match != nil {
+		dayStr = match[1]
+	}
+	day, err := parseAppleDate(dayStr, extraLayouts)
+	if dayStr == "" || err != nil {
+		var ok bool
+		if day, ok = dateFromFilename(htmlFilePath); !ok {
+			return ""
+		}
+	}
+	return m[day.Format("2006-01-02")]
+}
+
+// bodyTimeRegex matches a time of day starting a body line, e.g. "9:00 AM - woke up" or "14:30 train to Lyon".
+var bodyTimeRegex = regexp.MustCompile(`(?im)^[-*•]?\s*(\d{1,2}):(\d{2})(?:\s*([ap])\.?m\.?)?(?:$|[\s,:)–—-])`)
+
+// firstBodyTime returns the hour and minute of the first time of day that starts a line of the body,
+// for -extract-body-times. Only line starts count, so times mentioned mid-sentence are ignored;
+// the title, date header and quoted past entries are not part of the body.
+func firstBodyTime(pageContainer *goquery.Selection) (int, int, bool) {
+	hour, minute, found := 0, 0, false
+	pageContainer.Children().EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if s.Is("div.pageHeader, div.title, header") || isQuotedEntry(s) {
+			return true
+		}
+		fragment, err := goquery.OuterHtml(s)
+		if err != nil {
+			return true
+		}
+		for _, match := range bodyTimeRegex.FindAllStringSubmatch(plainTextFromHTML(fragment), -1) {
+			h, _ := strconv.Atoi(match[1])
+			m, _ := strconv.Atoi(match[2])
+			if m > 59 {
+				continue
+			}
+			switch strings.ToLower(match[3]) {
+			case "a", "p":
+				if h < 1 || h > 12 {
+					continue
+				}
+				h %= 12
+				if strings.EqualFold(match[3], "p") {
+					h += 12
+				}
+			default:
+				if h > 23 {
+					continue
+				}
+			}
+			hour, minute, found = h, m, true
+			return false
+		}
+		return true
+	})
+	return hour, minute, found
+}
+
+// isQuotedEntry reports whether a pageContainer child is an embedded past entry, as used by
+// "On This Day" entries: a blockquote/quotedEntry block, or any block carrying its own pageHeader.
+func isQuotedEntry(s *goquery.Selection) bool {
+	return s.Is("blockquote, div.quotedEntry, div.onThisDay") || s.Find("div.pageHeader").Length() > 0
+}
+
+// embeddedEntryMarkdown converts an embedded entry or previous version to markdown, returning its date
+// label ("" if it has none) and its body.
+func embeddedEntryMarkdown(s *goquery.Selection) (string, string) {
+	embedded := s.Clone()
+	dateSel := embedded.Find("div.pageHeader, header, time, .revisionDate").First()
+	dateStr := strings.Join(strings.Fields(dateSel.Text()), " ")
+	dateSel.Remove()
+
+	embeddedHtml, err := goquery.OuterHtml(embedded)
+	if err != nil {
+		return dateStr, ""
+	}
+	body, err := convertToMarkdown(embeddedHtml)
+	if err != nil {
+		body = embedded.Text()
+	}
+	return dateStr, strings.TrimSpace(body)
+}
+
+// renderQuotedEntry converts an embedded entry to a markdown blockquote starting with its date.
+func renderQuotedEntry(s *goquery.Selection) string {
+	dateStr, body := embeddedEntryMarkdown(s)
+	if dateStr == "" && body == "" {
+		return ""
+	}
+
+	var lines []string
+	if dateStr != "" {
+		lines = append(lines, "*"+dateStr+"*", "")
+	}
+	for _, line := range strings.Split(body, "\n") {
+		// The converter may already have produced a blockquote, don't nest it twice
+		line = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+		lines = append(lines, line)
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// dumpFailedFragment writes an HTML fragment the markdown converter failed on to debugDir, named
+// <entry file>-<entry uuid>-<fragment index>.html, so the failure can be reproduced from just that file.
+func dumpFailedFragment(debugDir, htmlFilePath, entryUUID string, index int, fragment string, convErr error) {
+	base := strings.TrimSuffix(filepath.Base(htmlFilePath), filepath.Ext(htmlFilePath))
+	dumpPath := filepath.Join(debugDir, fmt.Sprintf("%s-%s-%03d.html", base, entryUUID, index))
+	// The error goes in a comment, "--" would end it early
+	content := fmt.Sprintf("<!-- %s, fragment %d: %s -->\n%s\n", filepath.Base(htmlFilePath), index, strings.ReplaceAll(convErr.Error(), "--", "- -"), fragment)
+	if err := os.WriteFile(dumpPath, []byte(content), 0644); err != nil {
+		log.Printf("Warning: Could not write the failed fragment to %s: %v", dumpPath, err)
+		return
+	}
+	log.Printf("Wrote the failed fragment to %s", dumpPath)
+}
+
+// verboseErrorsMaxBytes limits how much HTML is logged per skipped entry with -verbose-errors.
+const verboseErrorsMaxBytes = 1000
+
+// logHTMLContext logs (the start of) the HTML of sel when -verbose-errors is enabled,
+// to make skipped entries debuggable without opening the export files.
+func logHTMLContext(opts entryOptions, label string, sel *goquery.Selection) {
+	if !opts.VerboseErrors {
+		return
+	}
+	if sel.Length() == 0 {
+		log.Printf("  HTML context (%s): <not present>", label)
+		return
+	}
+	htmlContent, err := goquery.OuterHtml(sel)
+	if err != nil {
+		log.Printf("  HTML context (%s): <unavailable: %v>", label, err)
+		return
+	}
+	if len(htmlContent) > verboseErrorsMaxBytes {
+		htmlContent = htmlContent[:verboseErrorsMaxBytes] + fmt.Sprintf("... (%d more bytes)", len(htmlContent)-verboseErrorsMaxBytes)
+	}
+	log.Printf("  HTML context (%s):\n%s", label, htmlContent)
+}
+
+// photoCaption returns the caption of a grid photo: text inside its gridItem, or an adjacent
+// caption element following the gridItem.
+func photoCaption(imgSel *goquery.Selection) string {
+	gridItem := imgSel.Closest("div.gridItem")
+	caption := strings.Join(strings.Fields(gridItem.Text()), " ")
+	if caption == "" {
+		if next := gridItem.Next(); next.Is(".caption, .assetCaption, figcaption") {
+			caption = strings.Join(strings.Fields(next.Text()), " ")
+		}
+	}
+	return caption
+}
+
+// memoryCaption returns the caption of a memory's header image or photo: a caption element inside
+// it, or the memoryCaption element that follows it.
+func memoryCaption(item *goquery.Selection) string {
+	caption := item.Find(".memoryCaption, .caption, figcaption").First()
+	if caption.Length() == 0 {
+		caption = item.Next().Filter(".memoryCaption")
+	}
+	return strings.Join(strings.Fields(caption.Text()), " ")
+}
+
+// imageDimensions returns the pixel size of an image, or zeros if its format can't be decoded (e.g. HEIC).
+func imageDimensions(imagePath string) (int, int) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
+
+// imageAttributeDimensions returns the size given by an <img>'s width and height attributes ("640" or "640px"),
+// or zeros unless both are positive whole numbers.
+func imageAttributeDimensions(imgSel *goquery.Selection) (int, int) {
+	attrPixels := func(name string) int {
+		value, _ := imgSel.Attr(name)
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "px"))
+		if err != nil || n <= 0 {
+			return 0
+		}
+		return n
+	}
+	width, height := attrPixels("width"), attrPixels("height")
+	if width == 0 || height == 0 {
+		return 0, 0
+	}
+	return width, height
+}
+
+// downscaleImage writes a copy of the image scaled to fit within maxDim x maxDim into destDir and
+// returns its path and size. Images already within bounds are returned unchanged. Re-encoding drops
+// metadata such as EXIF.
+func downscaleImage(imagePath string, maxDim int, destDir string) (string, int, int, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if cfg.Width <= maxDim && cfg.Height <= maxDim {
+		return imagePath, cfg.Width, cfg.Height, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", 0, 0, err
+	}
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	// Scale the longer side to maxDim, keeping the aspect ratio
+	width, height := maxDim, cfg.Height*maxDim/cfg.Width
+	if cfg.Height > cfg.Width {
+		width, height = cfg.Width*maxDim/cfg.Height, maxDim
+	}
+	width, height = max(width, 1), max(height, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", 0, 0, err
+	}
+	outPath := filepath.Join(destDir, newDayOneUUID()+strings.ToLower(filepath.Ext(imagePath)))
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(out, dst, &jpeg.Options{Quality: 90})
+	case "gif":
+		err = gif.Encode(out, dst, nil)
+	default:
+		err = png.Encode(out, dst)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("encoding %s: %w", format, err)
+	}
+	log.Printf("Downscaled %s from %dx%d to %dx%d.", filepath.Base(imagePath), cfg.Width, cfg.Height, width, height)
+	return outPath, width, height, nil
+}
+
+// dayOnePhotoTypes maps photo extensions to the type strings Day One accepts. Photos in any
+// other format are converted to PNG when they can be decoded.
+var dayOnePhotoTypes = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".jpe":  "jpeg",
+	".png":  "png",
+	".gif":  "gif",
+	".heic": "heic",
+	".heif": "heic",
+}
+
+// transcodeToPNG decodes imagePath (TIFF, BMP, WebP, ...) and writes it to destDir as a PNG.
+func transcodeToPNG(imagePath, destDir string) (string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", err
+	}
+	outPath := filepath.Join(destDir, newDayOneUUID()+".png")
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	err = png.Encode(out, img)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("encoding png: %w", err)
+	}
+	return outPath, nil
+}
+
+// monospaceFont matches CSS font declarations that name a fixed-width font.
+var monospaceFont = regexp.MustCompile(`(?i)font(-family)?\s*:[^;]*\b(menlo|monaco|courier|consolas|sf mono|andale mono|monospace)\b`)
+
+// cssRule and cssClass pick the rules and the class names of their selectors out of a <style> block.
+var cssRule = regexp.MustCompile(`([^{}]+)\{([^}]*)\}`)
+var cssClass = regexp.MustCompile(`\.([\w-]+)`)
+
+// monospaceClasses returns the classes the document's stylesheet gives a monospace font. Exports
+// style text through classes like p.p3 and span.s2 defined in <style> rather than inline.
+func monospaceClasses(doc *goquery.Document) map[string]bool {
+	classes := make(map[string]bool)
+	doc.Find("style").Each(func(i int, style *goquery.Selection) {
+		for _, rule := range cssRule.FindAllStringSubmatch(style.Text(), -1) {
+			if !monospaceFont.MatchString(rule[2]) {
+				continue
+			}
+			for _, class := range cssClass.FindAllStringSubmatch(rule[1], -1) {
+				classes[class[1]] = true
+			}
+		}
+	})
+	return classes
+}
+
+// hasMonospaceStyle reports whether the element has a monospace class or inline font.
+func hasMonospaceStyle(sel *goquery.Selection, classes map[string]bool) bool {
+	for _, class := range strings.Fields(sel.AttrOr("class", "")) {
+		if classes[class] {
+			return true
+		}
+	}
+	return monospaceFont.MatchString(sel.AttrOr("style", ""))
+}
+
+// isMonospaceBlock reports whether all the text of a body element is set in a monospace font.
+func isMonospaceBlock(s *goquery.Selection, classes map[string]bool) bool {
+	if s.Is("pre") {
+		return true
+	}
+	if strings.TrimSpace(s.Text()) == "" {
+		return false
+	}
+	allMono := true
+	var walk func(sel *goquery.Selection, inMono bool)
+	walk = func(sel *goquery.Selection, inMono bool) {
+		sel.Contents().Each(func(i int, child *goquery.Selection) {
+			if goquery.NodeName(child) == "#text" {
+				if !inMono && strings.TrimSpace(child.Text()) != "" {
+					allMono = false
+				}
+				return
+			}
+			walk(child, inMono || hasMonospaceStyle(child, classes))
+		})
+	}
+	walk(s, hasMonospaceStyle(s, classes))
+	return allMono
+}
+
+// preformattedText returns the text of a block exactly as laid out, keeping runs of spaces
+// (exported as &nbsp;) and line breaks.
+func preformattedText(s *goquery.Selection) string {
+	var b strings.Builder
+	var walk func(sel *goquery.Selection)
+	walk = func(sel *goquery.Selection) {
+		sel.Contents().Each(func(i int, child *goquery.Selection) {
+			switch goquery.NodeName(child) {
+			case "#text":
+				b.WriteString(child.Text())
+			case "br":
+				b.WriteString("\n")
+			default:
+				walk(child)
+				if child.Is("p, div") {
+					b.WriteString("\n")
+				}
+			}
+		})
+	}
+	walk(s)
+	return strings.Trim(strings.ReplaceAll(b.String(), "\u00a0", " "), "\n")
+}
+
+// photoImageSelector matches entry photos in the markups seen in exports: asset grid items,
+// <figure><img><figcaption> in a variant export, and the header image and photos of a memory.
+const photoImageSelector = "div.gridItem.assetType_photo img.asset_image, figure > img, div.memory > div.memoryHeader img, div.memory > div.memoryAsset img"
+
+// filenameDateRegex matches the YYYY-MM-DD prefix of entry filenames like 2025-05-14_The_Title.html.
+var filenameDateRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})`)
+
+// dateFromFilename returns noon UTC of the date prefix of the HTML filename, if it has one.
+func dateFromFilename(htmlFilePath string) (time.Time, bool) {
+	match := filenameDateRegex.FindStringSubmatch(filepath.Base(htmlFilePath))
+	if match == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02", match[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.UTC), true
+}
+
+// exifDateTimeOriginal reads the EXIF DateTimeOriginal of a JPEG, interpreted in loc since EXIF stores local time.
+func exifDateTimeOriginal(imagePath string, loc *time.Location) (time.Time, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	var marker [4]byte
+	if _, err := io.ReadFull(f, marker[:2]); err != nil || marker[0] != 0xFF || marker[1] != 0xD8 {
+		return time.Time{}, errors.New("not a JPEG file")
+	}
+	// Walk the JPEG segments until the APP1 Exif segment; EXIF always precedes the image data
+	for {
+		if _, err := io.ReadFull(f, marker[:]); err != nil {
+			return time.Time{}, fmt.Errorf("no EXIF segment: %w", err)
+		}
+		if marker[0] != 0xFF || marker[1] == 0xDA { // Start of scan: no more metadata
+			return time.Time{}, errors.New("no EXIF segment")
+		}
+		segLen := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if segLen < 0 {
+			return time.Time{}, errors.New("malformed JPEG segment")
+		}
+		seg := make([]byte, segLen)
+		if _, err := io.ReadFull(f, seg); err != nil {
+			return time.Time{}, err
+		}
+		if marker[1] == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffDateTimeOriginal(seg[6:], loc)
+		}
+	}
+}
+
+// tiffDateTimeOriginal finds DateTimeOriginal (0x9003) in the Exif sub-IFD of a TIFF-structured EXIF block.
+func tiffDateTimeOriginal(tiff []byte, loc *time.Location) (time.Time, error) {
+	if len(tiff) < 8 {
+		return time.Time{}, errors.New("truncated EXIF header")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, errors.New("bad EXIF byte order")
+	}
+	// findTag returns the value/offset field of the first entry with the given tag in the IFD at offset
+	findTag := func(offset uint32, tag uint16) ([]byte, uint32, bool) {
+		if int(offset)+2 > len(tiff) {
+			return nil, 0, false
+		}
+		count := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < count; i++ {
+			e := int(offset) + 2 + i*12
+			if e+12 > len(tiff) {
+				return nil, 0, false
+			}
+			if order.Uint16(tiff[e:]) == tag {
+				return tiff[e : e+12], order.Uint32(tiff[e+8:]), true
+			}
+		}
+		return nil, 0, false
+	}
+	_, exifIFD, ok := findTag(order.Uint32(tiff[4:]), 0x8769) // ExifIFDPointer in IFD0
+	if !ok {
+		return time.Time{}, errors.New("no Exif IFD")
+	}
+	entry, valueOffset, ok := findTag(exifIFD, 0x9003)
+	if !ok {
+		return time.Time{}, errors.New("no DateTimeOriginal")
+	}
+	n := order.Uint32(entry[4:])
+	if n < 19 || int(valueOffset)+19 > len(tiff) { // "2006:01:02 15:04:05" does not fit inline, so it is always at an offset
+		return time.Time{}, errors.New("malformed DateTimeOriginal")
+	}
+	return time.ParseInLocation("2006:01:02 15:04:05", string(tiff[valueOffset:valueOffset+19]), loc)
+}
+
+// earliestPhotoExifDate returns the earliest EXIF DateTimeOriginal among the local photos of an entry.
+func earliestPhotoExifDate(imgs *goquery.Selection, htmlFilePath string, loc *time.Location) (time.Time, bool) {
+	var earliest time.Time
+	imgs.Each(func(i int, img *goquery.Selection) {
+		src := imageSource(img)
+		if src == "" || isRemoteURL(src) {
+			return
+		}
+		t, err := exifDateTimeOriginal(filepath.Clean(filepath.Join(filepath.Dir(htmlFilePath), src)), loc)
+		if err != nil {
+			return // Non-JPEGs and photos without EXIF simply don't contribute
+		}
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	})
+	return earliest, !earliest.IsZero()
+}
+
+// plainTextFromHTML strips the tags from an HTML fragment, collapsing whitespace within lines.
+func plainTextFromHTML(htmlFrag string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlFrag))
+	if err != nil {
+		return ""
+	}
+	doc.Find("br").ReplaceWithHtml("\n") // Text() would run the lines together
+	var lines []string
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// photoFormatPreference ranks image formats by how widely supported they are, higher is better.
+var photoFormatPreference = map[string]int{".jpg": 5, ".jpeg": 5, ".png": 4, ".gif": 3, ".heic": 2, ".heif": 2}
+
+// findPhotoFormatDuplicates groups photos by their filename without extension and returns the
+// srcs to drop, keeping the most compatible format of each group.
+func findPhotoFormatDuplicates(imgs *goquery.Selection, htmlFilePath string) map[string]bool {
+	bestByStem := make(map[string]string)
+	duplicates := make(map[string]bool)
+	imgs.Each(func(i int, imgSel *goquery.Selection) {
+		src := imageSource(imgSel)
+		if src == "" {
+			return
+		}
+		ext := strings.ToLower(path.Ext(src))
+		stem := strings.TrimSuffix(src, path.Ext(src))
+		best, seen := bestByStem[stem]
+		if !seen {
+			bestByStem[stem] = src
+			return
+		}
+		if best == src {
+			return
+		}
+		if photoFormatPreference[ext] > photoFormatPreference[strings.ToLower(path.Ext(best))] {
+			log.Printf("Collapsing duplicate photo formats in %s: keeping %s, dropping %s", htmlFilePath, src, best)
+			duplicates[best] = true
+			bestByStem[stem] = src
+		} else {
+			log.Printf("Collapsing duplicate photo formats in %s: keeping %s, dropping %s", htmlFilePath, best, src)
+			duplicates[src] = true
+		}
+	})
+	return duplicates
+}
+
+// checklistItemState reports whether li is a checklist item and whether it is checked.
+// Items are recognised by a checkbox input, checked/unchecked style classes, data-checked/aria-checked
+// attributes, or being inside a list with a "checklist" class.
+func checklistItemState(li *goquery.Selection) (isChecklist bool, checked bool) {
+	if box := li.Find("input[type=checkbox]").First(); box.Length() > 0 {
+		_, checked = box.Attr("checked")
+		return true, checked
+	}
+	for _, attr := range []string{"data-checked", "aria-checked"} {
+		if value, ok := li.Attr(attr); ok {
+			return true, value == "true" || value == "1" || value == ""
+		}
+	}
+	for _, class := range strings.Fields(strings.ToLower(li.AttrOr("class", ""))) {
+		switch class {
+		case "checked", "done", "completed", "is-checked":
+			return true, true
+		case "unchecked", "todo", "not-checked":
+			return true, false
+		}
+	}
+	if li.ParentFiltered("ul, ol").Is(".checklist, .todo-list, .tasklist") {
+		return true, false
+	}
+	return false, false
+}
+
+// normalizeChecklistItems rewrites checklist items to start with a plain <input type="checkbox">,
+// the form the converter's task list rule turns into "- [ ]" / "- [x]".
+func normalizeChecklistItems(root *goquery.Selection) {
+	root.Find("li").Each(func(i int, li *goquery.Selection) {
+		isChecklist, checked := checklistItemState(li)
+		if !isChecklist {
+			return
+		}
+		li.Find("input[type=checkbox]").Remove()
+		if checked {
+			li.PrependHtml(`<input type="checkbox" checked>`)
+		} else {
+			li.PrependHtml(`<input type="checkbox">`)
+		}
+	})
+}
+
+// deviceTypeAndOS infers Day One's device type and OS name from a device name like "Mike's iPhone".
+func deviceTypeAndOS(deviceName string) (deviceType string, osName string) {
+	lower := strings.ToLower(deviceName)
+	switch {
+	case strings.Contains(lower, "iphone"):
+		return "iPhone", "iOS"
+	case strings.Contains(lower, "ipad"):
+		return "iPad", "iPadOS"
+	case strings.Contains(lower, "mac"):
+		return "Mac", "macOS"
+	}
+	return "", ""
+}
+
+// -cover-photo strategies. Day One has no cover field, its timeline shows the photo with
+// orderInEntry 0, so the strategy decides which photo that is.
+const (
+	coverPhotoNone    = "none"    // Leave orderInEntry unset and let Day One choose
+	coverPhotoFirst   = "first"   // The first photo in the entry
+	coverPhotoLargest = "largest" // The photo with the most pixels
+)
+
+// orderPhotosForCover moves the photo picked by strategy to the front and numbers the photos'
+// orderInEntry; the other photos keep their order of appearance.
+func orderPhotosForCover(photos []DayOnePhoto, strategy string) {
+	if strategy == coverPhotoNone || strategy == "" || len(photos) == 0 {
+		return
+	}
+	cover := 0
+	if strategy == coverPhotoLargest {
+		for i, p := range photos {
+			if p.Width*p.Height > photos[cover].Width*photos[cover].Height {
+				cover = i
+			}
+		}
+	}
+	coverPhoto := photos[cover]
+	copy(photos[1:cover+1], photos[:cover])
+	photos[0] = coverPhoto
+	for i := range photos {
+		order := i
+		photos[i].OrderInEntry = &order
+	}
+}
+
+// untitledFirstWords is the -rename-untitled value that titles untitled entries with the start of their body.
+const untitledFirstWords = "first-words"
+
+const untitledWordCount = 6
+
+var markdownImageToken = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+var markdownLinkSyntax = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+
+// titleRepeatsFirstLine reports whether the title equals, or is the beginning of, the first line of the body.
+func titleRepeatsFirstLine(title, markdownText string) bool {
+	firstLine, _, _ := strings.Cut(markdownText, "\n")
+	firstLine = markdownLinkSyntax.ReplaceAllString(firstLine, "$1")
+	firstLine = strings.NewReplacer("**", "", "__", "", "\\", "").Replace(firstLine)
+	firstLine = strings.Join(strings.Fields(strings.TrimLeft(firstLine, "#>*_ ")), " ")
+	title = strings.TrimSuffix(title, "…") // normalizeTitle truncated it
+	return title != "" && strings.HasPrefix(strings.ToLower(firstLine), strings.ToLower(title))
+}
+
+// firstWords returns the first n words of a markdown body, skipping image tokens and markup.
+func firstWords(markdownText string, n int) string {
+	text := markdownImageToken.ReplaceAllString(markdownText, " ")
+	text = markdownLinkSyntax.ReplaceAllString(text, "$1")
+	var words []string
+	for _, word := range strings.Fields(text) {
+		word = strings.Trim(word, "#*_>`~")
+		if word == "" || word == "-" || word == "[x]" || word == "[" || word == "]" {
+			continue
+		}
+		words = append(words, word)
+		if len(words) == n {
+			break
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// avMediaSource returns the file referenced by a video/audio grid item.
+func avMediaSource(gridItem *goquery.Selection) string {
+	for _, selector := range []string{"video[src]", "audio[src]", "source[src]"} {
+		if src := strings.TrimSpace(gridItem.Find(selector).First().AttrOr("src", "")); src != "" {
+			return src
+		}
+	}
+	return strings.TrimSpace(gridItem.Find("a[href]").First().AttrOr("href", ""))
+}
+
+// readEntryDocument opens and parses an entry HTML file.
+func readEntryDocument(htmlFilePath string) (*goquery.Document, error) {
+	file, err := os.Open(htmlFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening HTML file %s: %w", htmlFilePath, err)
+	}
+	defer file.Close()
+
+	// Decode according to the declared <meta> charset (UTF-8 when none is declared)
+	decodedReader, err := charset.NewReader(file, "text/html")
+	if err != nil {
+		return nil, fmt.Errorf("decoding HTML file %s: %w", htmlFilePath, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(decodedReader)
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTML file %s: %w", htmlFilePath, err)
+	}
+	return doc, nil
+}
+
+// checkEntryHTML inspects an entry HTML file for -check-input without converting it: that it parses, that
+// each dated section has a known page structure and a date that can be read, and that the media it
+// references exists. It returns the problems found.
+func checkEntryHTML(htmlFilePath string, opts entryOptions) []string {
+	doc, err := readEntryDocument(htmlFilePath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	sections := splitDatedSections(doc)
+	for i, section := range sections {
+		label := ""
+		if len(sections) > 1 {
+			label = fmt.Sprintf("section %d: ", i+1)
+		}
+		pageContainer := section.Find("div.pageContainer").First()
+		pageHeader := section.Find("div.pageHeader").First()
+		if pageContainer.Length() == 0 {
+			if article := section.Find("article").First(); article.Length() > 0 {
+				pageContainer = article
+				pageHeader, _ = articleHeaderParts(article)
+			}
+		}
+		if pageContainer.Length() == 0 {
+			problems = append(problems, label+"no div.pageContainer or <article>, the layout isn't supported")
+			continue
+		}
+
+		var dateProblem string
+		if datetime := timeElementDatetime(pageHeader, pageContainer); datetime != "" {
+			if _, _, _, err := parseDatetimeAttribute(datetime, time.UTC); err != nil {
+				dateProblem = fmt.Sprintf("<time datetime> can't be parsed: %v", err)
+			}
+		} else if dateStr := headerDateText(pageHeader.Text()); dateStr == "" {
+			dateProblem = "no date header"
+		} else if _, _, err := parseAppleDateTime(dateStr, time.UTC, opts.DateLayouts); err != nil {
+			dateProblem = fmt.Sprintf("date header '%s' can't be parsed (try -date-layout)", dateStr)
+		}
+		if dateProblem != "" {
+			if fileDate, ok := dateFromFilename(htmlFilePath); ok {
+				dateProblem += fmt.Sprintf("; the filename date %s would be used", fileDate.Format("2006-01-02"))
+			}
+			problems = append(problems, label+dateProblem)
+		}
+
+		if opts.NoMedia {
+			continue
+		}
+		var sources []string
+		pageContainer.Find(photoImageSelector).Each(func(j int, imgSel *goquery.Selection) {
+			sources = append(sources, imageSource(imgSel))
+		})
+		pageContainer.Find("div.gridItem.assetType_video, div.gridItem.assetType_audio").Each(func(j int, gridItem *goquery.Selection) {
+			sources = append(sources, avMediaSource(gridItem))
+		})
+		for _, src := range sources {
+			if src == "" || isRemoteURL(src) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(htmlFilePath), src)); err != nil {
+				problems = append(problems, fmt.Sprintf("%smedia file %s is missing", label, src))
+			}
+		}
+	}
+	return problems
+}
+
+// checkExport runs the -check-input inspection over the located export folders and prints a report of
+// the folders (relative to the extraction directory), the number of HTML files and every problem found
+// to stdout. It returns the problem count.
+func checkExport(exports []exportFolders, extractDir string, opts entryOptions) int {
+	relPath := func(path string) string {
+		if rel, err := filepath.Rel(extractDir, path); err == nil {
+			return rel
+		}
+		return path
+	}
+	problemCount := 0
+	for _, export := range exports {
+		fmt.Printf("Entries folder: %s\n", relPath(export.Entries))
+		if info, err := os.Stat(export.Resources); err != nil || !info.IsDir() {
+			fmt.Printf("Resources folder: %s is missing, entries with photos will lose them\n", relPath(export.Resources))
+			problemCount++
+		} else {
+			fmt.Printf("Resources folder: %s\n", relPath(export.Resources))
+		}
+		htmlFiles := 0
+		err := filepath.WalkDir(export.Entries, func(path string, d os.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				fmt.Printf("  %s: %v\n", relPath(path), walkErr)
+				problemCount++
+				return nil
+			}
+			if d.IsDir() || !isHTMLFile(d.Name()) {
+				return nil
+			}
+			htmlFiles++
+			rel, relErr := filepath.Rel(export.Entries, path)
+			if relErr != nil {
+				rel = path
+			}
+			for _, problem := range checkEntryHTML(path, opts) {
+				fmt.Printf("  %s: %s\n", rel, strings.ReplaceAll(problem, path, rel))
+				problemCount++
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("  Failed to read %s: %v\n", relPath(export.Entries), err)
+			problemCount++
+		}
+		fmt.Printf("HTML entry files: %d\n", htmlFiles)
+		if htmlFiles == 0 {
+			fmt.Println("  The Entries folder holds no HTML files.")
+			problemCount++
+		}
+	}
+	return problemCount
+}
+
+// processEntryHTML converts an Apple Journal HTML file. Most files hold one entry, but aggregated exports
+// can hold several, each starting at its own div.pageHeader; those become one entry per header. Sections
+// that fail are reported in the joined error alongside the entries that converted, as are media files
+// that weren't found (ErrMissingMedia), whose entries are converted without them.
+func processEntryHTML(htmlFilePath string, baseResourcesPath string, opts entryOptions) ([]DayOneEntry, map[string]string, error) {
+	doc, err := readEntryDocument(htmlFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dropSummaryBlocks(doc, htmlFilePath)
+	sections := splitDatedSections(doc)
+	if len(sections) == 1 {
+		entry, mediaToCopy, err := convertEntryDocument(doc, htmlFilePath, baseResourcesPath, opts)
+		if err != nil && !errors.Is(err, ErrMissingMedia) {
+			return nil, nil, err
+		}
+		return []DayOneEntry{entry}, mediaToCopy, err
+	}
+	log.Printf("Found %d date headers in %s, converting each section as its own entry.", len(sections), htmlFilePath)
+	sectionOpts := opts
+	sectionOpts.TitleFromFilename = false // The filename describes the whole file, not each section
+	var entries []DayOneEntry
+	var errs []error
+	mediaToCopy := make(map[string]string)
+	for i, section := range sections {
+		entry, sectionMedia, err := convertEntryDocument(section, htmlFilePath, baseResourcesPath, sectionOpts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("section %d: %w", i+1, err))
+			if !errors.Is(err, ErrMissingMedia) {
+				continue
+			}
+		}
+		entries = append(entries, entry)
+		for dayOnePath, original := range sectionMedia {
+			mediaToCopy[dayOnePath] = original
+		}
+	}
+	return entries, mediaToCopy, errors.Join(errs...)
+}
+
+// summaryLineMinWords is how many words a summary needs in one line before it's compared to the sub-entries,
+// so that a block of a few short words isn't dropped just because they recur somewhere.
+const summaryLineMinWords = 3
+
+// summaryBlockSelector matches the explicit summary markup of a file holding sub-entries. Only these
+// blocks are ever dropped; ordinary paragraphs are kept even when they repeat a sub-entry's words.
+const summaryBlockSelector = "div.summary"
+
+// isSubEntry reports whether a pageContainer child is an embedded entry of its own: a quotedEntry or
+// onThisDay block, or a block carrying a pageHeader. Unlike isQuotedEntry, a plain <blockquote> isn't one.
+func isSubEntry(s *goquery.Selection) bool {
+	return s.Is("div.quotedEntry, div.onThisDay") || s.Find("div.pageHeader").Length() > 0
+}
+
+// dropSummaryBlocks removes div.summary blocks that only summarize the sub-entries of the same file, so
+// their text isn't converted twice. Sub-entries are the sections after a second date header and embedded
+// entries (see isSubEntry); a summary block is dropped when each of its lines, without a trailing ellipsis
+// or "Label:" prefix, also appears in their text. The full text is kept.
+func dropSummaryBlocks(doc *goquery.Document, htmlFilePath string) {
+	pageContainer := doc.Find("div.pageContainer").First()
+	var candidates []*goquery.Selection
+	var subEntryText strings.Builder
+	headers := 0
+	pageContainer.Children().Each(func(i int, child *goquery.Selection) {
+		if child.Is("div.pageHeader") {
+			headers++
+		}
+		switch {
+		case headers > 1 || isSubEntry(child):
+			childHtml, _ := goquery.OuterHtml(child)
+			subEntryText.WriteString(plainTextFromHTML(childHtml) + "\n")
+		case child.Is(summaryBlockSelector):
+			candidates = append(candidates, child)
+		}
+	})
+	if subEntryText.Len() == 0 {
+		return
+	}
+	expanded := normalizeSummaryText(subEntryText.String())
+	for _, block := range candidates {
+		blockHtml, _ := goquery.OuterHtml(block)
+		summary := false
+		for _, line := range strings.Split(plainTextFromHTML(blockHtml), "\n") {
+			line = normalizeSummaryText(strings.TrimRight(strings.TrimSpace(line), ".…"))
+			if label, rest, ok := strings.Cut(line, ": "); ok && !strings.Contains(expanded, line) && !strings.Contains(label, " ") {
+				line = rest
+			}
+			if line == "" || !strings.Contains(expanded, line) {
+				summary = false
+				break
+			}
+			summary = summary || len(strings.Fields(line)) >= summaryLineMinWords
+		}
+		if summary {
+			log.Printf("Dropping a summary block of %s: its text is repeated in the full sub-entries of the same file.", htmlFilePath)
+			block.Remove()
+		}
+	}
+}
+
+// normalizeSummaryText lowercases text and collapses its whitespace, for comparing summaries to sub-entries.
+func normalizeSummaryText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// splitDatedSections splits a document whose pageContainer holds several div.pageHeader dates into one
+// document per header, each with the content up to the next header. Other documents are returned as is.
+func splitDatedSections(doc *goquery.Document) []*goquery.Document {
+	pageContainer := doc.Find("div.pageContainer").First()
+	if pageContainer.ChildrenFiltered("div.pageHeader").Length() <= 1 {
+		return []*goquery.Document{doc}
+	}
+	var sectionsHTML []*strings.Builder
+	pageContainer.Children().Each(func(i int, child *goquery.Selection) {
+		// Each header after the first starts a new section, content before the first header stays with the first
+		if len(sectionsHTML) == 0 || (child.Is("div.pageHeader") && child.PrevAllFiltered("div.pageHeader").Length() > 0) {
+			sectionsHTML = append(sectionsHTML, &strings.Builder{})
+		}
+		if childHTML, err := goquery.OuterHtml(child); err == nil {
+			sectionsHTML[len(sectionsHTML)-1].WriteString(childHTML)
+		}
+	})
+	sections := make([]*goquery.Document, 0, len(sectionsHTML))
+	for _, sectionHTML := range sectionsHTML {
+		section, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body><div class="pageContainer">` + sectionHTML.String() + `</div></body></html>`))
+		if err != nil {
+			continue
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// convertEntryDocument converts one parsed Apple Journal entry to a Day One entry and the media it references.
+func convertEntryDocument(doc *goquery.Document, htmlFilePath string, baseResourcesPath string, opts entryOptions) (DayOneEntry, map[string]string, error) {
+	entry := DayOneEntry{
+		UUID:     newDayOneUUID(),
+		Starred:  false, // Default
+		TimeZone: opts.DefaultTimeZone,
+		Photos:   make([]DayOnePhoto, 0),
+	}
+	mediaToCopy := make(map[string]string) // dayOneZipPath -> originalPath (one source file may back several entries' media)
+	var missingMedia []error               // ErrMissingMedia for each media file that couldn't be found, returned with the entry
+	// mediaZipPath places a media file in its flat media folder, or in a per-entry subfolder with -photos-subdir-by-entry.
+	// Moment tokens reference media by identifier, so either layout resolves the same way.
+	mediaZipPath := func(mediaDir, filename string) string {
+		if opts.MediaSubdirByEntry {
+			return filepath.Join(mediaDir, entry.UUID, filename)
+		}
+		return filepath.Join(mediaDir, filename)
+	}
+
+	// --- Check Structure ---
+	// Classic exports use div.pageContainer/div.pageHeader/div.title, newer ones use <article>/<header>.
+	// Detect per file so mixed exports still work.
+	pageContainer := doc.Find("div.pageContainer").First()
+	pageHeader := doc.Find("div.pageHeader").First()
+	titleSelection := doc.Find("div.title span.s2").First() // As seen in 2025-05-14 sample
+	if pageContainer.Length() == 0 {
+		if article := doc.Find("article").First(); article.Length() > 0 {
+			pageContainer = article
+			pageHeader, titleSelection = articleHeaderParts(article)
+		}
+	}
+	if pageContainer.Length() == 0 {
+		log.Printf("Warning: Unexpected HTML structure: no pageContainer in %s. This export layout may not be supported. Skipping entry.", htmlFilePath)
+		logHTMLContext(opts, "body", doc.Find("body"))
+		return DayOneEntry{}, nil, fmt.Errorf("%w: no div.pageContainer in %s", ErrUnsupportedLayout, htmlFilePath)
+	}
+
+	// --- Replace Emoji Images ---
+	// Emoji rendered as images are turned back into text so they aren't attached as photos
+	doc.Find("img").Each(func(i int, imgSel *goquery.Selection) {
+		if emoji := emojiFromImage(imgSel); emoji != "" {
+			imgSel.ReplaceWithHtml(html.EscapeString(emoji))
+		}
+	})
+
+	// --- Collapse Photo Format Duplicates ---
+	// IMG_1.heic and a derived IMG_1.jpg are the same photo, keep only the most compatible one
+	duplicatePhotoSrcs := make(map[string]bool)
+	if opts.DedupPhotoFormats {
+		duplicatePhotoSrcs = findPhotoFormatDuplicates(pageContainer.Find(photoImageSelector), htmlFilePath)
+	}
+
+	// --- Normalize Checklists ---
+	normalizeChecklistItems(doc.Selection)
+
+	// --- Extract Date ---
+	// Resolution order: a <time datetime> in the header, the header text, the date prefix of the filename,
+	// then the -base-date placeholder
+	dateStr := headerDateText(pageHeader.Text())
+	// -tz-per-entry-file overrides -tz for this entry; a timezone in the header still wins
+	if zone := opts.TimeZoneMap.zoneFor(htmlFilePath, dateStr, opts.DateLayouts); zone != "" {
+		entry.TimeZone = zone
+	}
+	defaultLoc, err := time.LoadLocation(entry.TimeZone)
+	if err != nil {
+		defaultLoc = time.UTC
+	}
+	var creationTime time.Time
+	var headerTimeZone string
+	var dateErr error
+	// Only a bare calendar date (header without a time, or the filename) may be refined by -extract-body-times
+	var dateOnly bool
+	datetime := timeElementDatetime(pageHeader, pageContainer)
+	if datetime != "" {
+		// The machine-readable date is exact, including the timezone; the header text is the fallback
+		var hasClock bool
+		if creationTime, headerTimeZone, hasClock, err = parseDatetimeAttribute(datetime, defaultLoc); err != nil {
+			log.Printf("Warning: Could not parse <time datetime=\"%s\"> of %s: %v. Using the header text instead.", datetime, htmlFilePath, err)
+			datetime = ""
+		}
+		dateOnly = !hasClock
+	}
+	if datetime == "" {
+		if dateStr == "" {
+			dateErr = fmt.Errorf("%w for %s", ErrNoDate, htmlFilePath)
+		} else if creationTime, headerTimeZone, err = parseAppleDateTime(dateStr, defaultLoc, opts.DateLayouts); err != nil {
+			dateErr = fmt.Errorf("%w '%s' for %s: %w", ErrUnparseableDate, dateStr, htmlFilePath, err)
+		}
+		dateOnly = dateErr != nil || !headerTimeRegex.MatchString(dateStr)
+	}
+	if dateErr != nil {
+		if fileDate, ok := dateFromFilename(htmlFilePath); ok {
+			log.Printf("Warning: %v. Using the date from the filename instead: %s", dateErr, fileDate.Format("2006-01-02"))
+			creationTime = fileDate
+		} else if exifDate, ok := earliestPhotoExifDate(pageContainer.Find(photoImageSelector), htmlFilePath, defaultLoc); ok {
+			log.Printf("Warning: %v. Using the date inferred from photo EXIF instead: %s", dateErr, exifDate.Format("2006-01-02 15:04:05"))
+			creationTime, dateOnly = exifDate, false
+		} else if !opts.BaseDate.IsZero() {
+			log.Printf("Warning: %v. No filename or photo EXIF date either, assigning placeholder -base-date %s.", dateErr, opts.BaseDate.Format("2006-01-02"))
+			creationTime, dateOnly = opts.BaseDate, false
+		} else {
+			if dateStr == "" {
+				log.Printf("Warning: No date found in pageHeader for %s. Skipping entry.", htmlFilePath)
+				logHTMLContext(opts, "pageContainer", pageContainer)
+			} else {
+				log.Printf("Warning: Could not parse date '%s' for %s: %v. Skipping entry.", dateStr, htmlFilePath, err)
+				logHTMLContext(opts, "pageHeader", pageHeader)
+			}
+			return DayOneEntry{}, nil, dateErr
+		}
+	}
+	if headerTimeZone != "" {
+		entry.TimeZone = headerTimeZone // Header timezone overrides the -tz default
+	}
+	if opts.ExtractBodyTimes && dateOnly {
+		if hour, minute, ok := firstBodyTime(pageContainer); ok {
+			year, month, day := creationTime.Date()
+			creationTime = time.Date(year, month, day, hour, minute, 0, 0, defaultLoc)
+			log.Printf("Using the time %02d:%02d from the body of %s as the entry time (the date has no time of day).", hour, minute, htmlFilePath)
+		}
+	}
+	isoDate := creationTime.UTC().Format(time.RFC3339) // "2006-01-02T15:04:05Z07:00"
+	entry.CreationDate = isoDate
+	entry.ModifiedDate = isoDate // Default modified to creation
+
+	// --- Device Attribution ---
+	entry.CreationDevice = opts.DeviceName
+	entry.CreationDeviceType, entry.CreationOSName = deviceTypeAndOS(opts.DeviceName)
+	if opts.DeviceOSName != "" {
+		entry.CreationOSName = opts.DeviceOSName
+	}
+
+	// --- Source Tag ---
+	if opts.TagSource {
+		// Lets users map a Day One entry back to the Apple Journal file it came from
+		entry.Tags = append(entry.Tags, "source/"+filepath.Base(htmlFilePath))
+	}
+
+	// --- Detect Star/Bookmark and Pin ---
+	if opts.StarSelector != "" && doc.Find(opts.StarSelector).Length() > 0 {
+		entry.Starred = true
+	}
+	if opts.PinSelector != "" && doc.Find(opts.PinSelector).Length() > 0 {
+		entry.IsPinned = true
+	}
+	suggestionMarked := opts.SuggestedSelector != "" && doc.Find(opts.SuggestedSelector).Length() > 0
+
+	// --- Previous Versions ---
+	// Blocks holding earlier revisions of the text are taken out of the body so they aren't mixed into it,
+	// then dropped, appended as quotes or kept in previousVersions depending on -edit-history
+	var previousVersions []*goquery.Selection
+	if opts.RevisionSelector != "" {
+		pageContainer.Find(opts.RevisionSelector).Each(func(i int, revision *goquery.Selection) {
+			previousVersions = append(previousVersions, revision.Clone())
+			revision.Remove()
+		})
+	}
+
+	// --- Extract Title ---
+	var entryTitle string
+	if titleSelection.Length() > 0 {
+		entryTitle = strings.TrimSpace(titleSelection.Text())
+	} else if opts.TitleFromFilename {
+		// Fallback to filename if it contains a title part
 		fn := filepath.Base(htmlFilePath)
-		fn = strings.TrimSuffix(fn, filepath.Ext(fn)) // Remove .html
-		parts := strings.SplitN(fn, "_", 2) // YYYY-MM-DD_The_Title
+		fn = strings.TrimSuffix(fn, filepath.Ext(fn))          // Remove .html
+		parts := strings.SplitN(fn, "_", 2)                    // YYYY-MM-DD_The_Title
 		if len(parts) > 1 && strings.Contains(parts[0], "-") { // Check if first part looks like a date
 			entryTitle = strings.ReplaceAll(parts[1], "_", " ")
 		}
 	}
+	entryTitle = normalizeTitle(entryTitle)
+
+	// --- Extract Body Content & Media ---
+	var bodyMarkdownBuilder strings.Builder
+	var currentPContent strings.Builder  // To accumulate content of a paragraph before converting
+	var plainTextBuilder strings.Builder // The body's text without markup, for -plain-text
+	var richText *richTextBuilder        // nil unless rich text generation is enabled
+	if opts.RichText {
+		richText = &richTextBuilder{}
+	}
+
+	// Helper function to convert accumulated paragraph content
+	fragmentIndex := 0 // Numbers the fragments of the entry for -debug-dir dumps
+	convertAndAppendP := func() {
+		if currentPContent.Len() > 0 {
+			fragmentIndex++
+			htmlFrag := currentPContent.String()
+			// Remove wrapping <p> if the converter adds its own, or ensure structure is simple
+			// For simple text, direct append might be fine after cleaning.
+			// For complex <p> with spans, converter is better.
+			var markdownFrag string
+			var err error
+			if opts.FlattenMarkdown {
+				markdownFrag = flattenToMarkdown(htmlFrag)
+			} else {
+				markdownFrag, err = fragmentToMarkdown(htmlFrag)
+			}
+			if err != nil {
+				// Keep the text rather than dropping the fragment
+				log.Printf("Warning: Markdown conversion error for a fragment in %s: %v. Using plain text instead.", htmlFilePath, err)
+				markdownFrag = plainTextFromHTML(htmlFrag)
+				if opts.DebugDir != "" {
+					dumpFailedFragment(opts.DebugDir, htmlFilePath, entry.UUID, fragmentIndex, htmlFrag, err)
+				}
+			}
+			if markdownFrag = strings.TrimSpace(markdownFrag); markdownFrag != "" {
+				bodyMarkdownBuilder.WriteString(markdownFrag + "\n\n")
+				richText.addFragment(htmlFrag)
+				if plain := plainTextFromHTML(htmlFrag); plain != "" {
+					plainTextBuilder.WriteString(plain + "\n\n")
+				}
+			}
+			currentPContent.Reset()
+		}
+	}
+
+	// Uncaptioned photos of one grid or figure group are written as a single gallery block:
+	// Day One shows moment tokens on the same line, without blank lines between them, together.
+	var galleryPhotos []string
+	flushGallery := func() {
+		if len(galleryPhotos) == 0 {
+			return
+		}
+		for _, photoUUID := range galleryPhotos {
+			bodyMarkdownBuilder.WriteString(fmt.Sprintf("![](dayone-moment://%s)", photoUUID))
+		}
+		bodyMarkdownBuilder.WriteString("\n\n")
+		richText.addGallery(galleryPhotos)
+		galleryPhotos = nil
+	}
+
+	// addPhoto attaches the image of a grid item or figure, emits its moment token and caption and
+	// returns the photo's identifier, or "" if it was skipped
+	addPhoto := func(imgSel *goquery.Selection, caption string) string {
+		imgSrc := imageSource(imgSel)
+		if imgSrc == "" {
+			return ""
+		}
+		if duplicatePhotoSrcs[imgSrc] {
+			return ""
+		}
+
+		// Path is relative from Entries/ folder, e.g., ../Resources/IMAGE_ID.png
+		// So, join with the directory of the current HTML file, then evaluate.
+		absImgSrc := filepath.Clean(filepath.Join(filepath.Dir(htmlFilePath), imgSrc))
+		if isRemoteURL(imgSrc) {
+			if !opts.FetchRemote {
+				log.Printf("Warning: Skipping remote image %s referenced in %s (use -fetch-remote to download it)", imgSrc, htmlFilePath)
+				return ""
+			}
+			downloadedPath, err := fetchRemoteImage(imgSrc, opts.RemoteMediaDir, opts.FetchTimeout)
+			if err != nil {
+				log.Printf("Warning: Failed to fetch remote image %s referenced in %s: %v", imgSrc, htmlFilePath, err)
+				missingMedia = append(missingMedia, fmt.Errorf("%w: fetching %s: %v", ErrMissingMedia, imgSrc, err))
+				return ""
+			}
+			absImgSrc = downloadedPath
+		}
+
+		source := absImgSrc
+		if isRemoteURL(imgSrc) {
+			source = imgSrc
+		}
+		originalImageName := filepath.Base(absImgSrc)
+		// Lowercased once here so IMG_1.PNG passes -image-types as ".png"
+		fileExt := strings.ToLower(filepath.Ext(originalImageName))
+		if !opts.ImageTypes[fileExt] {
+			log.Printf("Warning: Skipping image type '%s' from %s (not in -image-types)", fileExt, htmlFilePath)
+			return ""
+		}
+
+		// Check if image exists (absImgSrc is now relative to the root of the extracted archive)
+		if _, err := os.Stat(absImgSrc); os.IsNotExist(err) {
+			log.Printf("Warning: Image file not found: %s (referenced in %s)", absImgSrc, htmlFilePath)
+			missingMedia = append(missingMedia, fmt.Errorf("%w: %s", ErrMissingMedia, absImgSrc))
+			return ""
+		}
+
+		photoType, ok := dayOnePhotoTypes[fileExt]
+		if !ok {
+			convertedPath, err := transcodeToPNG(absImgSrc, opts.ConvertedMediaDir)
+			if err != nil {
+				log.Printf("Warning: Skipping photo %s from %s: Day One doesn't accept '%s' images and it couldn't be converted to PNG: %v", originalImageName, htmlFilePath, fileExt, err)
+				return ""
+			}
+			log.Printf("Converted %s to PNG; Day One doesn't accept '%s' images.", originalImageName, fileExt)
+			absImgSrc, photoType = convertedPath, "png"
+		}
+
+		width, height := 0, 0
+		if opts.MaxImageDimension > 0 {
+			resizedPath, w, h, err := downscaleImage(absImgSrc, opts.MaxImageDimension, opts.ConvertedMediaDir)
+			if err != nil {
+				log.Printf("Warning: Could not downscale %s: %v. Keeping the original.", absImgSrc, err)
+			} else {
+				absImgSrc, width, height = resizedPath, w, h
+			}
+		}
+		if width == 0 {
+			width, height = imageDimensions(absImgSrc)
+		}
+		if width == 0 {
+			// Formats the image package can't decode (e.g. HEIC) fall back to the size the HTML declares
+			width, height = imageAttributeDimensions(imgSel)
+		}
+
+		photoUUID := newDayOneUUID()
+		// Day One looks photos up as photos/<identifier>.<type>, so the filename uses the normalized type
+		dayOnePhotoFilename := photoUUID + "." + photoType
+		dayOnePhotoZipPath := mediaZipPath("photos", dayOnePhotoFilename)
+
+		md5Hash, err := calculateMD5(absImgSrc)
+		if err != nil {
+			log.Printf("Warning: Failed to calculate MD5 for %s: %v", absImgSrc, err)
+			return ""
+		}
+
+		photo := DayOnePhoto{
+			MD5:          md5Hash,
+			Type:         photoType,
+			Identifier:   photoUUID,
+			CreationDate: entry.CreationDate, // Use entry's creation date for photo
+			Width:        width,
+			Height:       height,
+			source:       source,
+		}
+		entry.Photos = append(entry.Photos, photo)
+		mediaToCopy[dayOnePhotoZipPath] = absImgSrc // Map the new DayOne path to the full path of the original file
+
+		// Day One photos have no caption field, so captions go on a line beneath the image,
+		// which ends the gallery the photo would otherwise have joined
+		if caption != "" {
+			flushGallery()
+			bodyMarkdownBuilder.WriteString(fmt.Sprintf("![](dayone-moment://%s)\n*%s*\n\n", photoUUID, caption))
+			richText.addPhoto(photoUUID)
+			richText.appendText(caption+"\n", richTextAttributes{Italic: true})
+			plainTextBuilder.WriteString(caption + "\n\n")
+		} else {
+			galleryPhotos = append(galleryPhotos, photoUUID)
+		}
+		return photoUUID
+	}
+
+	// addAVMedia attaches the video or audio file of a grid item and emits its moment token
+	addAVMedia := func(gridItem *goquery.Selection, kind string) {
+		src := avMediaSource(gridItem)
+		if src == "" {
+			log.Printf("Warning: No source found for %s grid item in %s", kind, htmlFilePath)
+			return
+		}
+		absSrc := filepath.Clean(filepath.Join(filepath.Dir(htmlFilePath), src))
+		if _, err := os.Stat(absSrc); err != nil {
+			log.Printf("Warning: %s file not found: %s (referenced in %s)", kind, absSrc, htmlFilePath)
+			missingMedia = append(missingMedia, fmt.Errorf("%w: %s", ErrMissingMedia, absSrc))
+			return
+		}
+		md5Hash, err := calculateMD5(absSrc)
+		if err != nil {
+			log.Printf("Warning: Failed to calculate MD5 for %s: %v", absSrc, err)
+			return
+		}
+		fileExt := strings.ToLower(filepath.Ext(absSrc))
+		flushGallery()
+		mediaUUID := newDayOneUUID()
+		if kind == "video" {
+			entry.Videos = append(entry.Videos, DayOneVideo{
+				MD5:          md5Hash,
+				Type:         strings.TrimPrefix(fileExt, "."),
+				Identifier:   mediaUUID,
+				CreationDate: entry.CreationDate,
+			})
+			mediaToCopy[mediaZipPath("videos", mediaUUID+fileExt)] = absSrc
+		} else {
+			entry.Audios = append(entry.Audios, DayOneAudio{
+				MD5:          md5Hash,
+				Format:       strings.TrimPrefix(fileExt, "."),
+				Identifier:   mediaUUID,
+				CreationDate: entry.CreationDate,
+			})
+			mediaToCopy[mediaZipPath("audios", mediaUUID+fileExt)] = absSrc
+		}
+		bodyMarkdownBuilder.WriteString(fmt.Sprintf("![](dayone-moment:/%s/%s)\n\n", kind, mediaUUID))
+		richText.addEmbedded(kind, mediaUUID)
+	}
+
+	// memoryCover is the identifier of the header image of a memory layout, if there is one
+	var memoryCover string
+
+	// Consecutive monospace blocks are gathered into one fenced code block with -preserve-whitespace
+	var monoClasses map[string]bool
+	if opts.PreserveWhitespace {
+		monoClasses = monospaceClasses(doc)
+	}
+	var codeLines []string
+	flushCodeBlock := func() {
+		if len(codeLines) == 0 {
+			return
+		}
+		code := strings.Join(codeLines, "\n")
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		bodyMarkdownBuilder.WriteString(fence + "\n" + code + "\n" + fence + "\n\n")
+		richText.appendText(code+"\n", richTextAttributes{})
+		plainTextBuilder.WriteString(code + "\n\n")
+		codeLines = nil
+	}
+
+	pageContainer.Children().Each(func(i int, s *goquery.Selection) {
+		if s.Is("div.pageHeader") { // Already processed
+			return
+		}
+		if s.Is("div.title") { // Already processed
+			return
+		}
+		if s.Is("header") { // <article> layout: date and title already processed
+			return
+		}
+
+		if opts.PreserveWhitespace && isMonospaceBlock(s, monoClasses) {
+			convertAndAppendP()
+			codeLines = append(codeLines, preformattedText(s))
+			return
+		}
+		flushCodeBlock()
+
+		// Handle embedded past entries ("On This Day") as a blockquote with their own date line
+		if isQuotedEntry(s) {
+			convertAndAppendP()
+			if quoted := renderQuotedEntry(s); quoted != "" {
+				bodyMarkdownBuilder.WriteString(quoted + "\n\n")
+				if quotedHtml, err := goquery.OuterHtml(s); err == nil {
+					richText.addFragment(quotedHtml)
+					plainTextBuilder.WriteString(plainTextFromHTML(quotedHtml) + "\n\n")
+				}
+			}
+			return
+		}
+
+		// Handle <figure> photos (variant export markup), alone or in a wrapper holding only figures
+		if s.Is("figure") || (s.Children().Length() > 0 && s.Children().Length() == s.ChildrenFiltered("figure").Length()) {
+			convertAndAppendP()
+			if opts.NoMedia {
+				return
+			}
+			s.Find("figure").AddSelection(s.Filter("figure")).Each(func(j int, figure *goquery.Selection) {
+				caption := strings.Join(strings.Fields(figure.ChildrenFiltered("figcaption").Text()), " ")
+				figure.ChildrenFiltered("img").Each(func(k int, imgSel *goquery.Selection) {
+					addPhoto(imgSel, caption)
+				})
+			})
+			flushGallery()
+			return
+		}
+
+		// Handle "memory" layouts: a header image, photos with captions before or after them, and
+		// narrative text, written in layout order. The header image is the entry's cover (see below).
+		if s.Is("div.memory") {
+			convertAndAppendP()
+			s.Children().Each(func(j int, part *goquery.Selection) {
+				switch {
+				case part.Is("div.memoryHeader, div.memoryAsset"):
+					if opts.NoMedia {
+						return
+					}
+					photoUUID := addPhoto(part.Find("img").First(), memoryCaption(part))
+					if part.Is("div.memoryHeader") && memoryCover == "" {
+						memoryCover = photoUUID
+					}
+				case part.Is(".memoryCaption") && part.Prev().Is("div.memoryHeader, div.memoryAsset"):
+					// Written with the photo it follows
+				default:
+					flushGallery()
+					if partHtml, err := goquery.OuterHtml(part); err == nil {
+						currentPContent.WriteString(partHtml)
+						convertAndAppendP()
+					}
+				}
+			})
+			flushGallery()
+			return
+		}
+
+		// Handle asset grid for photos
+		if s.Is("div.assetGrid") {
+			convertAndAppendP() // Convert any pending paragraph before the grid
+			if opts.NoMedia {
+				return
+			}
+			// Grid items are handled in DOM order so mixed photos/videos/audio keep their relative order.
+			// Nothing is written until an item validates, so a grid whose images are all missing leaves no
+			// blank lines or orphan tokens behind.
+			s.Find("div.gridItem").Each(func(j int, gridItem *goquery.Selection) {
+				switch {
+				case gridItem.HasClass("assetType_video"):
+					addAVMedia(gridItem, "video")
+					return
+				case gridItem.HasClass("assetType_audio"):
+					addAVMedia(gridItem, "audio")
+					return
+				case !gridItem.HasClass("assetType_photo"):
+					return
+				}
+				imgSel := gridItem.Find("img.asset_image").First()
+				addPhoto(imgSel, photoCaption(imgSel))
+			})
+			flushGallery()
+			return
+		}
+
+		// Handle body text paragraphs (p.p1, p.p2 as per samples, and div.bodyText itself)
+		// The structure is a bit inconsistent:
+		// 2023-12-12: <p class="p1"><span class="s1"><div class='bodyText'>...</div></span></p> <p class="p2">...</p>
+		// 2025-05-14: <p class="p1"><span class="s1">...<div class='bodyText'></span></p><p class="p2">...</p>
+		// We need to get the HTML content of these relevant text blocks.
+
+		// Attempt to get outer HTML of the selection, then convert
+		htmlContent, err := goquery.OuterHtml(s)
+		if err != nil {
+			log.Printf("Warning: Could not get HTML content for a section in %s: %v", htmlFilePath, err)
+			return
+		}
+		// The HTML structure is simple enough that the markdown converter should handle it.
+		// We are primarily interested in <p> tags within div.bodyText or at the same level as title/assetGrid.
+		// Filter for <p> or <div class="bodyText">
+		if s.Is("p") || s.Is("ul, ol") || s.Is("div.bodyText") || s.Parent().Is("div.bodyText") {
+			currentPContent.WriteString(htmlContent)
+			convertAndAppendP()
+		} else if s.Is("a[href]") || s.Find("a[href]").Length() > 0 {
+			// Links may sit outside the <p>/bodyText children picked out below, so convert
+			// the containing element as a whole to keep them as [text](url)
+			currentPContent.WriteString(htmlContent)
+			convertAndAppendP()
+		} else if s.Find("div.bodyText").Length() > 0 { // If bodyText is a child
+			s.Find("div.bodyText").Each(func(k int, bodyTextSel *goquery.Selection) {
+				bodyHtml, _ := goquery.OuterHtml(bodyTextSel)
+				currentPContent.WriteString(bodyHtml)
+				convertAndAppendP()
+			})
+		} else if s.Find("p").Length() > 0 { // If <p> is a child
+			s.Find("p").Each(func(k int, pSel *goquery.Selection) {
+				pHtml, _ := goquery.OuterHtml(pSel)
+				currentPContent.WriteString(pHtml)
+				convertAndAppendP()
+			})
+		}
+	})
+	flushCodeBlock()
+	convertAndAppendP() // Convert any last paragraph
+
+	entry.Text = strings.TrimSpace(bodyMarkdownBuilder.String())
+	if opts.StripEmoji {
+		// Before the title is compared with and injected into the text, so a title of only emoji adds no heading
+		entry.Text = strings.TrimSpace(stripEmoji(entry.Text))
+		entryTitle = normalizeTitle(stripEmoji(entryTitle))
+	}
+	// A suggestion the user wrote about at some length is their own writing
+	if suggestionMarked && len(strings.Fields(firstWords(entry.Text, suggestedMaxWords))) < suggestedMaxWords {
+		entry.suggested = true
+		if opts.TagSuggested {
+			entry.Tags = append(entry.Tags, "suggested")
+		}
+	}
+	injectTitle := true
+	if entryTitle != "" && titleRepeatsFirstLine(entryTitle, entry.Text) {
+		// Some exports have no real title and div.title just repeats the opening line
+		log.Printf("Title '%s' of %s repeats the first line of the body, not adding it as a heading.", entryTitle, htmlFilePath)
+		injectTitle = false
+	}
+	if entryTitle == "" && opts.UntitledLabel != "" {
+		if opts.UntitledLabel == untitledFirstWords {
+			entryTitle = normalizeTitle(firstWords(entry.Text, untitledWordCount))
+		} else {
+			entryTitle = opts.UntitledLabel
+		}
+	}
+	entry.title = entryTitle
+	plainText := strings.TrimSpace(plainTextBuilder.String())
+	if entryTitle != "" && injectTitle {
+		titleLine := renderTitle(opts.TitleFormat, entryTitle)
+		entry.Text = titleLine + "\n\n" + entry.Text
+		// Rich text can't take markdown, so mirror the heading level or bold styling of the title format
+		if level := len(titleLine) - len(strings.TrimLeft(titleLine, "#")); level >= 1 && level <= 6 {
+			richText.addHeading(entryTitle, level)
+		} else {
+			richText.prependLine(entryTitle, richTextAttributes{Bold: strings.HasPrefix(titleLine, "**") || strings.HasPrefix(titleLine, "__")})
+		}
+		plainText = strings.TrimSpace(entryTitle + "\n\n" + plainText)
+	}
+	switch {
+	case len(previousVersions) == 0:
+	case opts.EditHistory == editHistoryAppend:
+		// Day One has no collapsible blocks, so earlier versions follow the text under a rule, quoted
+		var history strings.Builder
+		for _, revision := range previousVersions {
+			if quoted := renderQuotedEntry(revision); quoted != "" {
+				history.WriteString("\n\n" + quoted)
+			}
+		}
+		if history.Len() > 0 {
+			entry.Text = strings.TrimSpace(entry.Text + "\n\n---\n\n*Previous versions*" + history.String())
+			richText.appendText("Previous versions\n", richTextAttributes{Italic: true})
+			for _, revision := range previousVersions {
+				if revisionHtml, err := goquery.OuterHtml(revision); err == nil {
+					richText.addFragment(revisionHtml)
+				}
+			}
+		}
+	case opts.EditHistory == editHistoryField:
+		for _, revision := range previousVersions {
+			if dateStr, body := embeddedEntryMarkdown(revision); body != "" {
+				if dateStr != "" {
+					body = "*" + dateStr + "*\n\n" + body
+				}
+				entry.PreviousVersions = append(entry.PreviousVersions, body)
+			}
+		}
+	default:
+		log.Printf("Dropped %d previous versions of %s, keeping the latest text (-edit-history latest).", len(previousVersions), htmlFilePath)
+	}
+	if isEmptyEntry(entry) && opts.KeepEmpty {
+		log.Printf("Entry %s has no content, keeping it with a placeholder body (-keep-empty).", htmlFilePath)
+		entry.Text = "*" + emptyEntryPlaceholder + "*"
+		richText.appendText(emptyEntryPlaceholder, richTextAttributes{Italic: true})
+		plainText = emptyEntryPlaceholder
+	}
+	if opts.PlainText {
+		entry.PlainText = plainText
+	}
+	if opts.StripEmoji {
+		// The rest is built from the HTML alongside the text; previous versions may have been appended to it
+		entry.Text = strings.TrimSpace(stripEmoji(entry.Text))
+		richText.stripEmoji()
+		entry.PlainText = strings.TrimSpace(stripEmoji(entry.PlainText))
+		for i, version := range entry.PreviousVersions {
+			entry.PreviousVersions[i] = stripEmoji(version)
+		}
+	}
+	if opts.WordCount {
+		// Counted on the plain text, so markdown syntax and moment tokens aren't words
+		if opts.StripEmoji {
+			plainText = stripEmoji(plainText)
+		}
+		entry.WordCount = countWords(plainText)
+	}
+	entry.RichText = richText.String()
+	coverStrategy := opts.CoverPhoto
+	if memoryCover != "" && coverStrategy != coverPhotoLargest {
+		// The header image of a memory is its cover; only -cover-photo largest picks another photo
+		if i := slices.IndexFunc(entry.Photos, func(p DayOnePhoto) bool { return p.Identifier == memoryCover }); i > 0 {
+			coverPhoto := entry.Photos[i]
+			copy(entry.Photos[1:i+1], entry.Photos[:i])
+			entry.Photos[0] = coverPhoto
+		}
+		coverStrategy = coverPhotoFirst
+	}
+	orderPhotosForCover(entry.Photos, coverStrategy)
+
+	if isEmptyEntry(entry) {
+		log.Printf("Warning: Entry %s resulted in no text and no media. Skipping.", htmlFilePath)
+		logHTMLContext(opts, "pageContainer", pageContainer)
+		return DayOneEntry{}, nil, fmt.Errorf("%w after processing %s", ErrEmptyEntry, htmlFilePath)
+	}
+
+	return entry, mediaToCopy, errors.Join(missingMedia...)
+}
+
+// marshalJournal encodes the journal as indented JSON, with keys in the order of Day One's own export.
+// With dayOneFormat the output also mimics the pretty printing of Day One's exporter (Apple's
+// JSONSerialization): " : " between key and value, and escaped forward slashes.
+func marshalJournal(journal DayOneJournal, dayOneFormat bool) ([]byte, error) {
+	jsonData, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil || !dayOneFormat {
+		return jsonData, err
+	}
+	var buf bytes.Buffer
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	if err := writeDayOneJSON(&buf, decoder, ""); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalJournalLines encodes the journal's entries as JSON Lines: one compact entry per line,
+// so streaming consumers can read entries without loading the whole journal. Metadata is not included.
+func marshalJournalLines(journal DayOneJournal) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, entry := range journal.Entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("entry %s: %w", entry.UUID, err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// writeDayOneJSON rewrites the next JSON value of decoder using Day One's pretty printing style,
+// keeping the order of object keys.
+func writeDayOneJSON(buf *bytes.Buffer, decoder *json.Decoder, indent string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch v := token.(type) {
+	case json.Delim:
+		closing := "}"
+		if v == '[' {
+			closing = "]"
+		}
+		buf.WriteString(string(v) + "\n")
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteString(indent + "  ")
+			if v == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				keyJSON, err := json.Marshal(key)
+				if err != nil {
+					return err
+				}
+				buf.Write(keyJSON)
+				buf.WriteString(" : ")
+			}
+			if err := writeDayOneJSON(buf, decoder, indent+"  "); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil { // The closing delimiter
+			return err
+		}
+		buf.WriteString("\n" + indent + closing)
+	case string:
+		// Apple's encoder doesn't HTML-escape but does escape forward slashes
+		var strBuf bytes.Buffer
+		encoder := json.NewEncoder(&strBuf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		buf.Write(bytes.ReplaceAll(bytes.TrimRight(strBuf.Bytes(), "\n"), []byte("/"), []byte("\\/")))
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+// --- Checkpointing ---
+
+// checkpointInterval is how many newly converted files are processed between checkpoint saves.
+const checkpointInterval = 25
+
+// checkpointState is the progress of a conversion, saved periodically so -resume can skip the
+// files an interrupted run already converted. It only applies to the same, unchanged input zip
+// converted with the same options.
+type checkpointState struct {
+	Input        string                    `json:"input"` // Absolute path of the input zip
+	InputSize    int64                     `json:"inputSize"`
+	InputModTime time.Time                 `json:"inputModTime"`
+	OptionsHash  string                    `json:"optionsHash"` // entryOptionsHash of the run's conversion options
+	Files        map[string]checkpointFile `json:"files"`       // By HTML path relative to the entries folder
+}
+
+// checkpointFile is the conversion result of one HTML file. Media sources are stored relative to the
+// extraction directory, which differs between runs.
+type checkpointFile struct {
+	Entries   []DayOneEntry     `json:"entries"`
+	Titles    []string          `json:"titles"`    // DayOneEntry.title isn't serialized, so titles are kept alongside
+	Suggested []bool            `json:"suggested"` // Likewise DayOneEntry.suggested
+	Media     map[string]string `json:"media"`     // Zip path -> source path relative to the extraction directory
+}
+
+// checkpointPath names the checkpoint after the input and output, in the -temp-dir or system temp
+// directory, so a rerun with the same arguments finds it.
+func checkpointPath(inputZip, output, tempDir string) string {
+	absInput, err := filepath.Abs(inputZip)
+	if err != nil {
+		absInput = inputZip
+	}
+	sum := sha256.Sum256([]byte(absInput + "\x00" + output))
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	return filepath.Join(tempDir, "applejournal_checkpoint_"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// entryOptionsHash fingerprints the options that shape converted entries, so a checkpoint written with
+// other options isn't resumed. Directories that differ between runs and logging options are left out.
+func entryOptionsHash(opts entryOptions) string {
+	titleFormat := ""
+	if opts.TitleFormat != nil && opts.TitleFormat.Tree != nil {
+		titleFormat = opts.TitleFormat.Tree.Root.String()
+	}
+	opts.TitleFormat = nil
+	opts.VerboseErrors, opts.DebugDir = false, ""
+	opts.ConvertedMediaDir, opts.RemoteMediaDir = "", ""
+	// encoding/json sorts map keys, so equal options always encode the same
+	data, err := json.Marshal(struct {
+		Options     entryOptions
+		TitleFormat string
+	}{opts, titleFormat})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// newCheckpoint starts an empty checkpoint for the input zip converted with opts.
+func newCheckpoint(inputZip string, opts entryOptions) *checkpointState {
+	c := &checkpointState{OptionsHash: entryOptionsHash(opts), Files: make(map[string]checkpointFile)}
+	c.Input, _ = filepath.Abs(inputZip)
+	if info, err := os.Stat(inputZip); err == nil {
+		c.InputSize, c.InputModTime = info.Size(), info.ModTime().UTC()
+	}
+	return c
+}
+
+// loadCheckpoint reads the checkpoint of an earlier run, starting over if there is none or the input
+// or the conversion options changed.
+func loadCheckpoint(path, inputZip string, opts entryOptions) *checkpointState {
+	current := newCheckpoint(inputZip, opts)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("No checkpoint found at %s, converting everything.", path)
+		return current
+	}
+	var saved checkpointState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("Warning: Ignoring unreadable checkpoint %s: %v", path, err)
+		return current
+	}
+	if saved.Input != current.Input || saved.InputSize != current.InputSize || !saved.InputModTime.Equal(current.InputModTime) {
+		log.Printf("Warning: Ignoring checkpoint %s, the input zip changed since it was written.", path)
+		return current
+	}
+	if saved.OptionsHash != current.OptionsHash {
+		log.Printf("Warning: Ignoring checkpoint %s, it was written with different conversion options.", path)
+		return current
+	}
+	if saved.Files == nil {
+		saved.Files = make(map[string]checkpointFile)
+	}
+	log.Printf("Resuming from checkpoint %s (%d converted files).", path, len(saved.Files))
+	return &saved
+}
+
+// record stores a converted file. Files with media outside the extraction directory can't be
+// restored in another run and are left out.
+func (c *checkpointState) record(relPath string, entries []DayOneEntry, media map[string]string, extractDir string) {
+	file := checkpointFile{Entries: entries, Media: make(map[string]string)}
+	for _, entry := range entries {
+		file.Titles = append(file.Titles, entry.title)
+		file.Suggested = append(file.Suggested, entry.suggested)
+	}
+	for zipPath, original := range media {
+		rel, err := filepath.Rel(extractDir, original)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return
+		}
+		file.Media[zipPath] = rel
+	}
+	c.Files[relPath] = file
+}
+
+// restore returns a file's checkpointed entries and media, rebased onto this run's extraction
+// directory. It reports false when the file isn't checkpointed or a media source is missing
+// (e.g. a downloaded or downscaled copy from the earlier run's temp directory).
+func (c *checkpointState) restore(relPath, extractDir string) ([]DayOneEntry, map[string]string, bool) {
+	file, ok := c.Files[relPath]
+	if !ok || len(file.Titles) != len(file.Entries) || len(file.Suggested) != len(file.Entries) {
+		return nil, nil, false
+	}
+	media := make(map[string]string, len(file.Media))
+	for zipPath, rel := range file.Media {
+		original := filepath.Join(extractDir, rel)
+		if _, err := os.Stat(original); err != nil {
+			return nil, nil, false
+		}
+		media[zipPath] = original
+	}
+	entries := make([]DayOneEntry, len(file.Entries))
+	for i, entry := range file.Entries {
+		entry.title = file.Titles[i]
+		entry.suggested = file.Suggested[i]
+		entries[i] = entry
+	}
+	return entries, media, true
+}
+
+// saveCheckpoint writes the checkpoint atomically. Failing to checkpoint only costs resumability.
+func saveCheckpoint(c *checkpointState, path string) {
+	data, err := json.Marshal(c)
+	if err == nil {
+		err = os.WriteFile(path+".tmp", data, 0644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		log.Printf("Warning: Could not save checkpoint %s: %v", path, err)
+	}
+}
+
+// createDayOneZip writes the Day One zip to outputZipPath, which is either a local file path
+// or an s3://bucket/key URL.
+func createDayOneZip(outputZipPath string, journal DayOneJournal, mediaToCopy map[string]string, tempExtractBasePath string, outOpts outputOptions) error {
+	if isS3URL(outputZipPath) {
+		// A single S3 PUT needs the content length up front, so stage the zip in the temp directory first
+		stagingFile, err := os.CreateTemp(tempExtractBasePath, "dayone_upload_*.zip")
+		if err != nil {
+			return fmt.Errorf("creating staging file for %s: %w", outputZipPath, err)
+		}
+		defer os.Remove(stagingFile.Name())
+		defer stagingFile.Close()
+
+		if err := writeDayOneZip(stagingFile, journal, mediaToCopy, outOpts); err != nil {
+			return err
+		}
+		if outOpts.SelfCheck {
+			// Check the staged copy, so a broken zip is never uploaded
+			info, err := stagingFile.Stat()
+			if err != nil {
+				return fmt.Errorf("self-check of %s: %w", outputZipPath, err)
+			}
+			zr, err := zip.NewReader(stagingFile, info.Size())
+			if err != nil {
+				return fmt.Errorf("self-check of %s: %w", outputZipPath, err)
+			}
+			if err := verifyDayOneZip(zr); err != nil {
+				return fmt.Errorf("self-check of %s: %w", outputZipPath, err)
+			}
+			log.Printf("Self-check passed for %s.", outputZipPath)
+		}
+		log.Printf("Uploading zip to %s", outputZipPath)
+		if err := uploadToS3(outputZipPath, stagingFile); err != nil {
+			return fmt.Errorf("uploading to %s: %w", outputZipPath, err)
+		}
+		return nil
+	}
+
+	// Write next to the destination and rename when complete, so a failed run never leaves a
+	// truncated zip that looks like finished output
+	partialPath := outputZipPath + ".partial"
+	zipFile, err := os.Create(partialPath)
+	if err != nil {
+		return fmt.Errorf("creating output zip %s: %w", outputZipPath, err)
+	}
+	defer os.Remove(partialPath) // No-op once renamed
+	if err := writeDayOneZip(zipFile, journal, mediaToCopy, outOpts); err != nil {
+		zipFile.Close()
+		return err
+	}
+	if err := zipFile.Close(); err != nil {
+		return err
+	}
+	if outOpts.SelfCheck {
+		if err := selfCheckZipFile(partialPath); err != nil {
+			return fmt.Errorf("self-check of %s: %w", outputZipPath, err)
+		}
+		log.Printf("Self-check passed for %s.", outputZipPath)
+	}
+	return os.Rename(partialPath, outputZipPath)
+}
+
+// selfCheckZipFile opens a written zip file and verifies it with verifyDayOneZip.
+func selfCheckZipFile(zipPath string) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return verifyDayOneZip(&zr.Reader)
+}
+
+// momentTokenRegex matches the media tokens of an entry body, capturing the identifier:
+// dayone-moment://<photo> and dayone-moment:/<kind>/<id> for videos, audio and PDFs.
+var momentTokenRegex = regexp.MustCompile(`dayone-moment:/(?:/|(?:video|audio|pdf)/)([0-9A-Za-z-]+)`)
+
+// verifyDayOneZip reads back every file of a written Day One zip (so the CRC catches truncation),
+// checks that Journal.json parses and that each photo, video and audio it references is in the archive,
+// that every moment token of the entry bodies resolves to one of its entry's media files in the archive,
+// and that every media file is referenced by a token. A photo may be referenced more than once.
+func verifyDayOneZip(zr *zip.Reader) error {
+	mediaNames := make(map[string]bool) // Base names, media may be nested with -photos-subdir-by-entry
+	var journal *DayOneJournal
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", f.Name, err)
+		}
+		if isJournalFile(f.Name) {
+			journal, err = decodeJournal(f.Name, rc)
+		} else {
+			mediaNames[path.Base(f.Name)] = true
+			_, err = io.Copy(io.Discard, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+	}
+	if journal == nil {
+		return errors.New("Journal.json (or Journal.jsonl) is missing")
+	}
+
+	var missing, mismatched []string
+	referenced := make(map[string]bool) // Identifiers with a token, in any entry
+	for _, entry := range journal.Entries {
+		var expected []string
+		identifiers := make(map[string]bool)
+		for _, p := range entry.Photos {
+			expected = append(expected, p.Identifier+"."+p.Type)
+			identifiers[p.Identifier] = true
+		}
+		for _, v := range entry.Videos {
+			expected = append(expected, v.Identifier+"."+v.Type)
+			identifiers[v.Identifier] = true
+		}
+		for _, a := range entry.Audios {
+			expected = append(expected, a.Identifier+"."+a.Format)
+			identifiers[a.Identifier] = true
+		}
+		for _, name := range expected {
+			if !mediaNames[name] {
+				missing = append(missing, fmt.Sprintf("%s (entry %s)", name, entry.UUID))
+			}
+		}
+
+		// A token without media shows as a broken placeholder
+		for _, match := range momentTokenRegex.FindAllStringSubmatch(entry.Text, -1) {
+			referenced[match[1]] = true
+			if !identifiers[match[1]] {
+				mismatched = append(mismatched, fmt.Sprintf("entry %s has a token for %s but no such media", entry.UUID, match[1]))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%d referenced media files are missing from the zip: %s", len(missing), strings.Join(missing, ", "))
+	}
+	// Media without a token is invisible in its entry
+	var unreferenced []string
+	for name := range mediaNames {
+		if !referenced[strings.TrimSuffix(name, path.Ext(name))] {
+			unreferenced = append(unreferenced, name)
+		}
+	}
+	sort.Strings(unreferenced)
+	for _, name := range unreferenced {
+		mismatched = append(mismatched, fmt.Sprintf("media %s is referenced by no token", name))
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("the entry bodies' moment tokens and the media files don't match: %s", strings.Join(mismatched, "; "))
+	}
+	return nil
+}
+
+// isJournalFile reports whether a zip entry is the journal: a top-level .json or .jsonl file.
+// It's usually Journal.json, but named after the journal with -journal-per-year.
+func isJournalFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return !strings.Contains(name, "/") && (ext == ".json" || ext == ".jsonl")
+}
+
+// decodeJournal reads a Journal.json, or the entries of a Journal.jsonl (-format jsonl).
+func decodeJournal(name string, r io.Reader) (*DayOneJournal, error) {
+	journal := &DayOneJournal{}
+	if !strings.EqualFold(path.Ext(name), ".jsonl") {
+		return journal, json.NewDecoder(r).Decode(journal)
+	}
+	decoder := json.NewDecoder(r)
+	for decoder.More() {
+		var entry DayOneEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, err
+		}
+		journal.Entries = append(journal.Entries, entry)
+	}
+	return journal, nil
+}
+
+// readJournalFromZip reads the journal of an existing Day One zip, e.g. a previous conversion for -diff.
+func readJournalFromZip(zipPath string) (*DayOneJournal, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !isJournalFile(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		journal, err := decodeJournal(f.Name, rc)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		return journal, nil
+	}
+	return nil, errors.New("Journal.json (or Journal.jsonl) is missing")
+}
+
+// zipContentKinds are the kinds of files in a Day One zip: the journal file and each media folder.
+var zipContentKinds = []string{"journal", "photos", "videos", "audios"}
+
+// parseStoreKinds parses -store, a comma-separated list of zipContentKinds; "media" stands for all media folders.
+func parseStoreKinds(list string) (map[string]bool, error) {
+	kinds := make(map[string]bool)
+	for _, kind := range strings.Split(list, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		switch {
+		case kind == "":
+		case kind == "media":
+			kinds["photos"], kinds["videos"], kinds["audios"] = true, true, true
+		case slices.Contains(zipContentKinds, kind):
+			kinds[kind] = true
+		default:
+			return nil, fmt.Errorf("unknown kind '%s', expected media or %s", kind, strings.Join(zipContentKinds, ", "))
+		}
+	}
+	return kinds, nil
+}
+
+// zipMethod returns the compression method of a zip entry: zip.Store if its kind is in stored, else zip.Deflate.
+// Photos and videos are compressed already, so deflating them costs time for next to no size.
+func zipMethod(zipPath string, stored map[string]bool) uint16 {
+	kind := strings.SplitN(filepath.ToSlash(zipPath), "/", 2)[0]
+	if isJournalFile(filepath.ToSlash(zipPath)) {
+		kind = "journal"
+	}
+	if stored[kind] {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// writeDayOneZip writes Journal.json and the media files as a zip archive to w.
+func writeDayOneZip(w io.Writer, journal DayOneJournal, mediaToCopy map[string]string, outOpts outputOptions) error {
+	zipWriter := zip.NewWriter(w)
+	defer zipWriter.Close()
+
+	// Add Journal.json (or Journal.jsonl); Day One names the imported journal after this file
+	baseName := outOpts.JournalName
+	if baseName == "" {
+		baseName = "Journal"
+	}
+	journalName := baseName + ".json"
+	var jsonData []byte
+	var err error
+	if outOpts.JSONLines {
+		journalName = baseName + ".jsonl"
+		jsonData, err = marshalJournalLines(journal)
+	} else {
+		jsonData, err = marshalJournal(journal, outOpts.DayOneFormat)
+	}
+	if err != nil {
+		return fmt.Errorf("marshalling journal data to JSON: %w", err)
+	}
+	jsonHeader := &zip.FileHeader{Name: journalName, Method: zipMethod(journalName, outOpts.StoredKinds)}
+	if outOpts.PreserveMtime {
+		jsonHeader.Modified = latestModifiedDate(journal)
+	}
+	jsonWriter, err := zipWriter.CreateHeader(jsonHeader)
+	if err != nil {
+		return fmt.Errorf("creating %s in zip: %w", journalName, err)
+	}
+	if _, err := jsonWriter.Write(jsonData); err != nil {
+		return fmt.Errorf("writing %s to zip: %w", journalName, err)
+	}
+
+	// Add media files. Importers resolve zip entries by name (case-insensitively on macOS), so a
+	// duplicate name would make one file shadow another; refuse rather than write an ambiguous zip.
+	zipNames := map[string]string{strings.ToLower(journalName): journalName}
+	for dayOneZipPath, originalPath := range mediaToCopy {
+		// originalPath is an absolute path to the file in the temp extraction directory
+		dayOneZipPath = filepath.ToSlash(dayOneZipPath)
+		if existing, ok := zipNames[strings.ToLower(dayOneZipPath)]; ok {
+			return fmt.Errorf("zip entry %s for %s collides with %s", dayOneZipPath, originalPath, existing)
+		}
+		zipNames[strings.ToLower(dayOneZipPath)] = dayOneZipPath
+		mediaFile, err := os.Open(originalPath)
+		if err != nil {
+			log.Printf("Warning: Opening original media file %s: %v. Skipping this media file.", originalPath, err)
+			continue
+		}
+		defer mediaFile.Close() // Close inside loop for each file
+
+		mediaHeader := &zip.FileHeader{Name: dayOneZipPath, Method: zipMethod(dayOneZipPath, outOpts.StoredKinds)}
+		if outOpts.PreserveMtime {
+			if info, err := mediaFile.Stat(); err == nil {
+				mediaHeader.Modified = info.ModTime()
+			}
+		}
+		mediaWriter, err := zipWriter.CreateHeader(mediaHeader)
+		if err != nil {
+			log.Printf("Warning: Creating %s in zip: %v. Skipping this media file.", dayOneZipPath, err)
+			continue
+		}
+
+		var mediaReader io.Reader = mediaFile
+		if info, err := mediaFile.Stat(); err == nil && info.Size() >= progressSizeThreshold {
+			mediaReader = newProgressReader(mediaFile, filepath.Base(originalPath), info.Size())
+		}
+		if _, err := io.Copy(mediaWriter, mediaReader); err != nil {
+			log.Printf("Warning: Copying media file %s to zip: %v. Skipping this media file.", originalPath, err)
+			continue
+		}
+		log.Printf("Copied %s to %s in zip.", originalPath, dayOneZipPath)
+	}
+
+	return zipWriter.Close()
+}
+
+// --- Copy Progress ---
+
+// Media files at least this large get periodic progress logging while they're copied,
+// so slow network volumes don't look like a hang.
+const (
+	progressSizeThreshold = 20 << 20 // 20 MB
+	progressLogInterval   = 2 * time.Second
+)
+
+// progressReader logs the amount copied and the throughput every progressLogInterval.
+type progressReader struct {
+	r         io.Reader
+	name      string
+	total     int64
+	copied    int64
+	started   time.Time
+	lastLogAt time.Time
+}
+
+func newProgressReader(r io.Reader, name string, total int64) *progressReader {
+	now := timeNow()
+	return &progressReader{r: r, name: name, total: total, started: now, lastLogAt: now}
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.copied += int64(n)
+	if now := timeNow(); now.Sub(p.lastLogAt) >= progressLogInterval {
+		p.lastLogAt = now
+		elapsed := now.Sub(p.started).Seconds()
+		log.Printf("Copying %s: %.1f / %.1f MB (%.1f MB/s)", p.name, float64(p.copied)/(1<<20), float64(p.total)/(1<<20), float64(p.copied)/(1<<20)/elapsed)
+	}
+	return n, err
+}
+
+// --- S3 Output ---
+// Uploads use a single SigV4 signed PUT with credentials from the standard AWS environment variables
+// (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, optional AWS_SESSION_TOKEN, AWS_REGION).
+// AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) selects an S3-compatible endpoint using path-style URLs.
+
+// s3MaxPutSize is the largest object S3 accepts in a single PUT; bigger ones need a multipart upload.
+const s3MaxPutSize = 5 << 30 // 5 GB
+
+func isS3URL(p string) bool {
+	return strings.HasPrefix(strings.ToLower(p), "s3://")
+}
+
+// s3Credentials are the credentials and region S3 requests are signed with.
+type s3Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // Set for temporary credentials (STS, SSO, assumed roles)
+	Region       string
+}
+
+// s3CredentialsFromEnv reads the credentials from the AWS environment variables. Shared config and
+// credentials files aren't read, so a profile has to be exported to the environment first.
+func s3CredentialsFromEnv() (s3Credentials, error) {
+	creds := s3Credentials{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Region:       os.Getenv("AWS_REGION"),
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+			return creds, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set: profiles from ~/.aws aren't read, "+
+				"export the credentials of profile %s with: eval \"$(aws configure export-credentials --profile %s --format env)\"", profile, profile)
+		}
+		return creds, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set (with AWS_SESSION_TOKEN for temporary credentials)")
+	}
+	if creds.Region == "" {
+		creds.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if creds.Region == "" {
+		creds.Region = "us-east-1"
+	}
+	return creds, nil
+}
+
+func uploadToS3(s3URL string, body *os.File) error {
+	parsed, err := url.Parse(s3URL)
+	if err != nil {
+		return err
+	}
+	bucket := parsed.Host
+	key := strings.TrimPrefix(parsed.Path, "/")
+	if bucket == "" || key == "" {
+		return fmt.Errorf("expected s3://bucket/key, got %s", s3URL)
+	}
+	info, err := body.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > s3MaxPutSize {
+		return fmt.Errorf("the zip is %.1f GB, S3 accepts at most 5 GB in a single upload: write it to a local file "+
+			"(or split it with -split-by year) and upload it with the AWS CLI", float64(info.Size())/(1<<30))
+	}
+	creds, err := s3CredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	var requestURL string
+	if endpoint != "" {
+		endpointURL, err := url.Parse(endpoint)
+		if err != nil {
+			return fmt.Errorf("parsing S3 endpoint %s: %w", endpoint, err)
+		}
+		requestURL = endpointURL.Scheme + "://" + endpointURL.Host + strings.TrimRight(endpointURL.Path, "/") + "/" + s3EscapePath(bucket) + "/" + s3EscapePath(key)
+	} else {
+		requestURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, creds.Region, s3EscapePath(key))
+	}
+
+	// Hash the payload, then rewind for the upload
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, io.NewSectionReader(body, 0, info.Size()))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, requestURL, io.NewSectionReader(body, 0, size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/zip")
+	signS3Request(req, hex.EncodeToString(hasher.Sum(nil)), creds)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected HTTP status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// signS3Request signs a request without a query string with AWS Signature Version 4 at timeNow: it sets
+// the x-amz-date, x-amz-content-sha256 (payloadHash, the hex SHA-256 of the body) and, for temporary
+// credentials, x-amz-security-token headers, then the Authorization header. The host and every header
+// already set are signed. It returns the canonical request, which tests compare with AWS's examples.
+func signS3Request(req *http.Request, payloadHash string, creds s3Credentials) string {
+	now := timeNow().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), "", canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	credentialScope := dateStamp + "/" + creds.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, credentialScope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretKey), dateStamp)
+	signingKey = hmacSHA256(signingKey, creds.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKey, credentialScope, signedHeaders, signature))
+	return canonicalRequest
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath URI-encodes an object key for SigV4, keeping the "/" separators.
+func s3EscapePath(key string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(key) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || strings.IndexByte("-._~/", b) >= 0 {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// latestModifiedDate returns the most recent entry modification date, used as Journal.json's timestamp.
+func latestModifiedDate(journal DayOneJournal) time.Time {
+	var latest time.Time
+	for _, entry := range journal.Entries {
+		if t, err := time.Parse(time.RFC3339, entry.ModifiedDate); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// splitJournalByYear partitions the journal's entries by the year of their creation date.
+// Entries whose creation date can't be parsed are grouped under year 0.
+func splitJournalByYear(journal DayOneJournal) map[int]DayOneJournal {
+	byYear := make(map[int]DayOneJournal)
+	for _, entry := range journal.Entries {
+		year := 0
+		if t, err := time.Parse(time.RFC3339, entry.CreationDate); err == nil {
+			year = t.Year()
+		} else {
+			log.Printf("Warning: Could not parse creation date '%s' of entry %s for splitting: %v", entry.CreationDate, entry.UUID, err)
+		}
+		yearJournal, ok := byYear[year]
+		if !ok {
+			yearJournal = DayOneJournal{Metadata: journal.Metadata, Entries: make([]DayOneEntry, 0)}
+		}
+		yearJournal.Entries = append(yearJournal.Entries, entry)
+		byYear[year] = yearJournal
+	}
+	return byYear
+}
+
+// splitOutputPath derives the zip path for one year from the -o value.
+// If -o is an existing directory (or ends with a separator) the zip is written inside it as journal-YYYY.zip,
+// otherwise -o is treated as a file prefix ("out.zip" -> "out-YYYY.zip").
+func splitOutputPath(output string, year int) string {
+	if isS3URL(output) {
+		if strings.HasSuffix(output, "/") {
+			return fmt.Sprintf("%sjournal-%d.zip", output, year)
+		}
+		return fmt.Sprintf("%s-%d.zip", strings.TrimSuffix(output, path.Ext(output)), year)
+	}
+	if info, err := os.Stat(output); (err == nil && info.IsDir()) || strings.HasSuffix(output, string(os.PathSeparator)) || strings.HasSuffix(output, "/") {
+		return filepath.Join(output, fmt.Sprintf("journal-%d.zip", year))
+	}
+	prefix := output
+	if strings.EqualFold(filepath.Ext(prefix), ".zip") {
+		prefix = strings.TrimSuffix(prefix, filepath.Ext(prefix))
+	}
+	return fmt.Sprintf("%s-%d.zip", prefix, year)
+}
+
+// entryMediaIdentifiers lists the identifiers of an entry's photos, videos and audio.
+func entryMediaIdentifiers(entry DayOneEntry) []string {
+	var ids []string
+	for _, photo := range entry.Photos {
+		ids = append(ids, photo.Identifier)
+	}
+	for _, video := range entry.Videos {
+		ids = append(ids, video.Identifier)
+	}
+	for _, audio := range entry.Audios {
+		ids = append(ids, audio.Identifier)
+	}
+	return ids
+}
+
+// defaultLongTextLimit is the entry length, in characters, above which Day One may struggle with an entry.
+const defaultLongTextLimit = 100000
+
+// splitLongEntry splits an entry whose text is longer than limit characters into continuation
+// entries, breaking between paragraphs where possible. The first part keeps the entry's UUID;
+// each part carries the photos, videos and audio it references and is dated a second after
+// the previous part so they sort in order. Rich and plain text can't be split, so parts have none.
+func splitLongEntry(entry DayOneEntry, limit int, titleFormat *template.Template) []DayOneEntry {
+	chunks := splitTextChunks(entry.Text, limit)
+	if len(chunks) <= 1 {
+		return []DayOneEntry{entry}
+	}
+	created, createdErr := time.Parse(time.RFC3339, entry.CreationDate)
+	parts := make([]DayOneEntry, 0, len(chunks))
+	for i, chunk := range chunks {
+		part := entry
+		part.RichText, part.PlainText = "", ""
+		if entry.WordCount > 0 {
+			// Without plain text, a part's words are those firstWords finds in its markdown
+			part.WordCount = countWords(firstWords(chunk, -1))
+		}
+		part.Photos, part.Videos, part.Audios = nil, nil, nil
+		if i > 0 {
+			part.UUID = newDayOneUUID()
+			heading := fmt.Sprintf("(continued, part %d of %d)", i+1, len(chunks))
+			if entry.title != "" {
+				heading = fmt.Sprintf("%s (part %d of %d)", entry.title, i+1, len(chunks))
+			}
+			chunk = renderTitle(titleFormat, heading) + "\n\n" + chunk
+			if createdErr == nil {
+				part.CreationDate = created.Add(time.Duration(i) * time.Second).UTC().Format(time.RFC3339)
+			}
+		}
+		part.Text = chunk
+		for _, photo := range entry.Photos {
+			if strings.Contains(chunk, photo.Identifier) {
+				part.Photos = append(part.Photos, photo)
+			}
+		}
+		for _, video := range entry.Videos {
+			if strings.Contains(chunk, video.Identifier) {
+				part.Videos = append(part.Videos, video)
+			}
+		}
+		for _, audio := range entry.Audios {
+			if strings.Contains(chunk, audio.Identifier) {
+				part.Audios = append(part.Audios, audio)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
 
+// splitTextChunks splits markdown text into chunks of at most limit characters, preferring
+// paragraph boundaries and falling back to line and then word boundaries for oversized paragraphs.
+// Words are never cut, so a chunk may exceed limit when a single word does.
+func splitTextChunks(text string, limit int) []string {
+	var chunks []string
+	for utf8.RuneCountInString(text) > limit {
+		cut := string([]rune(text)[:limit])
+		at := -1
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			if i := strings.LastIndex(cut, sep); i > 0 {
+				at = i
+				break
+			}
+		}
+		if at < 0 {
+			// A single word (or moment token) longer than the limit is kept whole rather than cut
+			at = len(text)
+			if i := strings.IndexAny(text[len(cut):], " \n"); i >= 0 {
+				at = len(cut) + i
+			}
+		}
+		chunks = append(chunks, strings.TrimSpace(text[:at]))
+		text = strings.TrimSpace(text[at:])
+	}
+	return append(chunks, text)
+}
 
-	// --- Extract Body Content & Media ---
-	var bodyMarkdownBuilder strings.Builder
-	var currentPContent strings.Builder // To accumulate content of a paragraph before converting
+// mediaForEntries selects the media files referenced by the given entries' photos, videos and audio.
+// Media zip paths are named after the photo identifier, so match on that.
+func mediaForEntries(entries []DayOneEntry, allMedia map[string]string) map[string]string {
+	identifiers := make(map[string]bool)
+	for _, entry := range entries {
+		for _, id := range entryMediaIdentifiers(entry) {
+			identifiers[id] = true
+		}
+	}
+	media := make(map[string]string)
+	for dayOneZipPath, originalPath := range allMedia {
+		base := filepath.Base(dayOneZipPath)
+		if identifiers[strings.TrimSuffix(base, filepath.Ext(base))] {
+			media[dayOneZipPath] = originalPath
+		}
+	}
+	return media
+}
 
-	// Helper function to convert accumulated paragraph content
-	convertAndAppendP := func() {
-		if currentPContent.Len() > 0 {
-			htmlFrag := currentPContent.String()
-			// Remove wrapping <p> if the converter adds its own, or ensure structure is simple
-			// For simple text, direct append might be fine after cleaning.
-			// For complex <p> with spans, converter is better.
-			markdownFrag, err := markdownConverter.ConvertString(htmlFrag)
-			if err != nil {
-				log.Printf("Warning: Markdown conversion error for a fragment in %s: %v", htmlFilePath, err)
-			} else {
-				bodyMarkdownBuilder.WriteString(strings.TrimSpace(markdownFrag) + "\n\n")
+// checkMediaSources opens the source file of each media file to write (Day One zip path -> original path)
+// and returns, by zip path, why the ones that are missing or unreadable can't be copied, with their entry.
+func checkMediaSources(entries []DayOneEntry, media map[string]string) map[string]string {
+	entryByIdentifier := make(map[string]DayOneEntry)
+	for _, entry := range entries {
+		for _, id := range entryMediaIdentifiers(entry) {
+			entryByIdentifier[id] = entry
+		}
+	}
+	problems := make(map[string]string)
+	for dayOneZipPath, originalPath := range media {
+		f, err := os.Open(originalPath)
+		if err == nil {
+			// Reading catches directories and files that open but can't be read
+			_, err = f.Read(make([]byte, 1))
+			f.Close()
+			if err == io.EOF {
+				err = nil
 			}
-			currentPContent.Reset()
 		}
+		if err == nil {
+			continue
+		}
+		base := filepath.Base(dayOneZipPath)
+		entry := entryByIdentifier[strings.TrimSuffix(base, filepath.Ext(base))]
+		problems[dayOneZipPath] = fmt.Sprintf("entry %s of %s: %v", entry.UUID, entry.CreationDate, err)
+	}
+	return problems
+}
+
+// dropUnreadableMedia leaves the media files checkMediaSources finds missing or unreadable out of media
+// and removes them from the entries, with their tokens and richText embeds, logging them in one place.
+func dropUnreadableMedia(entries []DayOneEntry, media map[string]string) {
+	problems := checkMediaSources(entries, media)
+	if len(problems) == 0 {
+		return
+	}
+	log.Printf("Warning: %d of %d media files are missing or unreadable and will be left out of the output, along with their placeholders in the entries:", len(problems), len(media))
+	zipPaths := make([]string, 0, len(problems))
+	for zipPath := range problems {
+		zipPaths = append(zipPaths, zipPath)
 	}
+	sort.Strings(zipPaths)
+	dropped := make(map[string]bool)
+	for _, zipPath := range zipPaths {
+		log.Printf("  %s (%s)", filepath.ToSlash(zipPath), problems[zipPath])
+		delete(media, zipPath)
+		base := filepath.Base(zipPath)
+		dropped[strings.TrimSuffix(base, filepath.Ext(base))] = true
+	}
+	dropEntryMedia(entries, dropped)
+}
 
+// momentEmbedRegex matches a whole markdown image holding a moment token, capturing the identifier.
+var momentEmbedRegex = regexp.MustCompile(`!\[[^\]]*\]\(dayone-moment:/(?:/|(?:video|audio|pdf)/)([0-9A-Za-z-]+)\)`)
 
-	doc.Find("div.pageContainer").Children().Each(func(i int, s *goquery.Selection) {
-		if s.Is("div.pageHeader") { // Already processed
-			return
+// dropEntryMedia removes the photos, videos and audio with the given identifiers from the entries, along
+// with their moment tokens and richText embeds, so no entry points at media that isn't in the output.
+func dropEntryMedia(entries []DayOneEntry, identifiers map[string]bool) {
+	for i := range entries {
+		entry := &entries[i]
+		var photos []DayOnePhoto
+		for _, photo := range entry.Photos {
+			if !identifiers[photo.Identifier] {
+				photos = append(photos, photo)
+			}
 		}
-		if s.Is("div.title") { // Already processed
-			return
+		var videos []DayOneVideo
+		for _, video := range entry.Videos {
+			if !identifiers[video.Identifier] {
+				videos = append(videos, video)
+			}
 		}
+		var audios []DayOneAudio
+		for _, audio := range entry.Audios {
+			if !identifiers[audio.Identifier] {
+				audios = append(audios, audio)
+			}
+		}
+		if len(photos) == len(entry.Photos) && len(videos) == len(entry.Videos) && len(audios) == len(entry.Audios) {
+			continue
+		}
+		entry.Photos, entry.Videos, entry.Audios = photos, videos, audios
 
-		// Handle asset grid for photos
-		if s.Is("div.assetGrid") {
-			convertAndAppendP() // Convert any pending paragraph before the grid
-			s.Find("div.gridItem.assetType_photo img.asset_image").Each(func(j int, imgSel *goquery.Selection) {
-				imgSrc, exists := imgSel.Attr("src")
-				if !exists || imgSrc == "" {
-					return
+		dropTokens := func(line string) string {
+			return momentEmbedRegex.ReplaceAllStringFunc(line, func(token string) string {
+				if identifiers[momentEmbedRegex.FindStringSubmatch(token)[1]] {
+					return ""
 				}
+				return token
+			})
+		}
+		// A line that held only dropped tokens goes; when it was a paragraph of its own, so does one of
+		// the blank lines around it
+		lines := strings.Split(entry.Text, "\n")
+		var kept []string
+		for j := 0; j < len(lines); j++ {
+			line := dropTokens(lines[j])
+			if line == "" && lines[j] != "" {
+				blankBefore := len(kept) == 0 || kept[len(kept)-1] == ""
+				switch {
+				case blankBefore && j+1 < len(lines) && lines[j+1] == "":
+					j++
+				case blankBefore && j+1 == len(lines) && len(kept) > 0:
+					kept = kept[:len(kept)-1]
+				}
+				continue
+			}
+			kept = append(kept, line)
+		}
+		entry.Text = strings.Join(kept, "\n")
 
-				// Path is relative from Entries/ folder, e.g., ../Resources/IMAGE_ID.png
-				// So, join with the directory of the current HTML file, then evaluate.
-				absImgSrc := filepath.Clean(filepath.Join(filepath.Dir(htmlFilePath), imgSrc))
-				
-				originalImageName := filepath.Base(absImgSrc)
-				fileExt := strings.ToLower(filepath.Ext(originalImageName))
-				if fileExt != ".png" && fileExt != ".jpg" && fileExt != ".jpeg" && fileExt != ".gif" {
-					log.Printf("Warning: Skipping non-image media type '%s' from %s", fileExt, htmlFilePath)
-					return
+		if entry.RichText != "" {
+			var doc richTextDocument
+			if err := json.Unmarshal([]byte(entry.RichText), &doc); err == nil {
+				runs := doc.Contents[:0]
+				for _, run := range doc.Contents {
+					objects := run.EmbeddedObjects[:0]
+					for _, object := range run.EmbeddedObjects {
+						if !identifiers[object.Identifier] {
+							objects = append(objects, object)
+						}
+					}
+					if run.EmbeddedObjects = objects; run.Text != "" || len(objects) > 0 {
+						runs = append(runs, run)
+					}
 				}
+				doc.Contents = runs
+				if data, err := json.Marshal(doc); err == nil {
+					entry.RichText = string(data)
+				}
+			}
+		}
+	}
+}
 
+// countWords counts the words of plain text: whitespace-separated runs holding a letter or digit, so
+// dashes, bullets and emoji on their own aren't counted.
+func countWords(text string) int {
+	words := 0
+	for _, field := range strings.Fields(text) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) >= 0 {
+			words++
+		}
+	}
+	return words
+}
 
-				// Check if image exists (absImgSrc is now relative to the root of the extracted archive)
-				if _, err := os.Stat(absImgSrc); os.IsNotExist(err) {
-					log.Printf("Warning: Image file not found: %s (referenced in %s)", absImgSrc, htmlFilePath)
-					return
+// printJournalStats prints aggregate entry/photo counts and the covered date span to stdout.
+func printJournalStats(journal DayOneJournal) {
+	photoCount, wordCount := 0, 0
+	wordsByYear := make(map[int]int) // With -word-count, for journaling volume over time
+	var earliest, latest time.Time
+	for _, entry := range journal.Entries {
+		photoCount += len(entry.Photos)
+		wordCount += entry.WordCount
+		t, err := time.Parse(time.RFC3339, entry.CreationDate)
+		if err != nil {
+			continue
+		}
+		wordsByYear[t.Year()] += entry.WordCount
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+		if latest.IsZero() || t.After(latest) {
+			latest = t
+		}
+	}
+	fmt.Printf("Entries: %d\n", len(journal.Entries))
+	fmt.Printf("Photos:  %d\n", photoCount)
+	if earliest.IsZero() {
+		fmt.Println("Dates:   n/a")
+	} else {
+		fmt.Printf("Dates:   %s to %s\n", earliest.Format("2006-01-02"), latest.Format("2006-01-02"))
+	}
+	if wordCount > 0 {
+		years := make([]int, 0, len(wordsByYear))
+		for year := range wordsByYear {
+			years = append(years, year)
+		}
+		sort.Ints(years)
+		perYear := make([]string, 0, len(years))
+		for _, year := range years {
+			perYear = append(perYear, fmt.Sprintf("%d: %d", year, wordsByYear[year]))
+		}
+		fmt.Printf("Words:   %d (%s)\n", wordCount, strings.Join(perYear, ", "))
+	}
+}
+
+// --- Diff Against a Previous Output ---
+
+// dayOneEntryLink matches links between entries, whose UUIDs differ from run to run.
+var dayOneEntryLink = regexp.MustCompile(`dayone://view\?entryId=[0-9A-Fa-f-]+`)
+
+// diffContentKey is entryContentKey ignoring which entry a link between entries points to.
+func diffContentKey(entry DayOneEntry) string {
+	entry.Text = dayOneEntryLink.ReplaceAllString(entry.Text, "dayone://view?entryId=")
+	return entryContentKey(entry)
+}
+
+type changedEntry struct {
+	Old, New DayOneEntry
+}
+
+type journalDiff struct {
+	Added     []DayOneEntry
+	Removed   []DayOneEntry
+	Changed   []changedEntry
+	Unchanged int
+}
+
+// diffJournals compares a previous output's entries with this run's. Entries match by UUID, then by
+// content (UUIDs are random per run); entries left over on both sides with the same creation date
+// count as changed, the rest as added or removed.
+func diffJournals(oldEntries, newEntries []DayOneEntry) journalDiff {
+	var diff journalDiff
+	used := make([]bool, len(oldEntries))
+	oldByUUID := make(map[string]int)
+	oldByKey := make(map[string][]int)
+	for i, entry := range oldEntries {
+		oldByUUID[entry.UUID] = i
+		key := diffContentKey(entry)
+		oldByKey[key] = append(oldByKey[key], i)
+	}
+	var unmatched []DayOneEntry
+	for _, entry := range newEntries {
+		key := diffContentKey(entry)
+		if i, ok := oldByUUID[entry.UUID]; ok && !used[i] {
+			used[i] = true
+			if diffContentKey(oldEntries[i]) == key {
+				diff.Unchanged++
+			} else {
+				diff.Changed = append(diff.Changed, changedEntry{Old: oldEntries[i], New: entry})
+			}
+			continue
+		}
+		matched := false
+		for _, i := range oldByKey[key] {
+			if !used[i] {
+				used[i], matched = true, true
+				diff.Unchanged++
+				break
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, entry)
+		}
+	}
+	for _, entry := range unmatched {
+		matched := false
+		for i, old := range oldEntries {
+			if !used[i] && old.CreationDate == entry.CreationDate {
+				used[i], matched = true, true
+				diff.Changed = append(diff.Changed, changedEntry{Old: old, New: entry})
+				break
+			}
+		}
+		if !matched {
+			diff.Added = append(diff.Added, entry)
+		}
+	}
+	for i, old := range oldEntries {
+		if !used[i] {
+			diff.Removed = append(diff.Removed, old)
+		}
+	}
+	return diff
+}
+
+// changedFields names what differs between two versions of an entry.
+func changedFields(before, after DayOneEntry) []string {
+	var fields []string
+	if dayOneEntryLink.ReplaceAllString(before.Text, "") != dayOneEntryLink.ReplaceAllString(after.Text, "") {
+		fields = append(fields, "text")
+	}
+	if before.CreationDate != after.CreationDate {
+		fields = append(fields, fmt.Sprintf("date %s -> %s", before.CreationDate, after.CreationDate))
+	}
+	if len(before.Photos) != len(after.Photos) || len(before.Videos) != len(after.Videos) || len(before.Audios) != len(after.Audios) {
+		fields = append(fields, fmt.Sprintf("media %d -> %d", len(before.Photos)+len(before.Videos)+len(before.Audios), len(after.Photos)+len(after.Videos)+len(after.Audios)))
+	}
+	if before.Starred != after.Starred || before.IsPinned != after.IsPinned {
+		fields = append(fields, "starred/pinned")
+	}
+	if strings.Join(before.Tags, ",") != strings.Join(after.Tags, ",") {
+		fields = append(fields, "tags")
+	}
+	if len(fields) == 0 {
+		fields = append(fields, "media content") // Same counts, different files
+	}
+	return fields
+}
+
+// diffEntryLabel describes an entry in the diff by its date and first words.
+func diffEntryLabel(entry DayOneEntry) string {
+	date := entry.CreationDate
+	if t, err := time.Parse(time.RFC3339, entry.CreationDate); err == nil {
+		date = t.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s %q (%s)", date, firstWords(entry.Text, 8), entry.UUID)
+}
+
+// printJournalDiff prints the added (+), removed (-) and changed (~) entries and a summary.
+func printJournalDiff(diff journalDiff) {
+	for _, entry := range diff.Added {
+		fmt.Printf("+ %s\n", diffEntryLabel(entry))
+	}
+	for _, entry := range diff.Removed {
+		fmt.Printf("- %s\n", diffEntryLabel(entry))
+	}
+	for _, change := range diff.Changed {
+		fmt.Printf("~ %s: %s\n", diffEntryLabel(change.New), strings.Join(changedFields(change.Old, change.New), ", "))
+	}
+	fmt.Printf("%d added, %d removed, %d changed, %d unchanged\n", len(diff.Added), len(diff.Removed), len(diff.Changed), diff.Unchanged)
+}
+
+// --- Markdown Output ---
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// filenameIllegalChars are characters some filesystem rejects in a filename (Windows is the strictest).
+const filenameIllegalChars = `/\:*?"<>|`
+
+// sanitizeFilenamePart turns a title into a filename part for -sanitize-filenames. Unlike the
+// default ASCII slug it keeps letters and digits of any script and their case; everything else
+// (illegal characters, punctuation, spaces, emoji) becomes a single replacement.
+func sanitizeFilenamePart(title, replacement string) string {
+	var b strings.Builder
+	lastReplaced := false
+	for _, r := range title {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '-' || r == '_' {
+			b.WriteRune(r)
+			lastReplaced = false
+		} else if !lastReplaced {
+			b.WriteString(replacement)
+			lastReplaced = true
+		}
+	}
+	return strings.Trim(b.String(), replacement+"-_")
+}
+
+// truncateFilenamePart shortens s to at most maxBytes bytes without splitting a character.
+func truncateFilenamePart(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	cut := 0
+	for i := range s {
+		if i > maxBytes {
+			break
+		}
+		cut = i
+	}
+	return s[:cut]
+}
+
+// markdownFilename builds "YYYY-MM-DD-title.md" (or "YYYY-MM-DD.md" for untitled entries) for an
+// entry, uniquified against usedNames by appending -2, -3, ... when two entries share a date and title.
+// With -sanitize-filenames the title part is sanitizeFilenamePart's and the whole name is kept within
+// FilenameMaxLength bytes. The full title stays in the front matter either way.
+func markdownFilename(entry DayOneEntry, usedNames map[string]bool, outOpts outputOptions) string {
+	datePart := entry.CreationDate
+	if t, err := time.Parse(time.RFC3339, entry.CreationDate); err == nil {
+		datePart = t.Format("2006-01-02")
+	}
+	slug := strings.Trim(slugInvalidChars.ReplaceAllString(strings.ToLower(entry.title), "-"), "-")
+	separator := "-"
+	if outOpts.SanitizeFilenames {
+		slug = sanitizeFilenamePart(entry.title, outOpts.FilenameReplacement)
+		separator = outOpts.FilenameReplacement
+	}
+	for n := 1; ; n++ {
+		suffix := ".md"
+		if n > 1 {
+			suffix = fmt.Sprintf("-%d.md", n)
+		}
+		titlePart := slug
+		if outOpts.SanitizeFilenames {
+			titlePart = strings.TrimRight(truncateFilenamePart(slug, outOpts.FilenameMaxLength-len(datePart)-len(separator)-len(suffix)), outOpts.FilenameReplacement+"-_")
+		}
+		name := datePart + suffix
+		if titlePart != "" {
+			name = datePart + separator + titlePart + suffix
+		}
+		// Compared case-insensitively, macOS and Windows filesystems would make such names collide
+		if !usedNames[strings.ToLower(name)] {
+			usedNames[strings.ToLower(name)] = true
+			return name
+		}
+	}
+}
+
+// minFilenameMaxLength leaves room for "YYYY-MM-DD-2.md" and a few characters of title.
+const minFilenameMaxLength = 24
+
+// writeMarkdownExport writes each entry as a Markdown file with front matter into outputDir,
+// copying media into outputDir/photos and rewriting moment tokens to relative file links.
+func writeMarkdownExport(outputDir string, journal DayOneJournal, mediaToCopy map[string]string, outOpts outputOptions) error {
+	for _, mediaDir := range []string{"photos", "videos", "audios"} {
+		if err := os.MkdirAll(filepath.Join(outputDir, mediaDir), 0755); err != nil {
+			return fmt.Errorf("creating output directory %s: %w", outputDir, err)
+		}
+	}
+
+	// Moment tokens reference photos by identifier, map those to their copied file
+	mediaByIdentifier := make(map[string]string)
+	for dayOneZipPath, originalPath := range mediaToCopy {
+		base := filepath.Base(dayOneZipPath)
+		mediaByIdentifier[strings.TrimSuffix(base, filepath.Ext(base))] = filepath.ToSlash(dayOneZipPath)
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(outputDir, dayOneZipPath)), 0755); err != nil {
+			return fmt.Errorf("creating media directory for %s: %w", dayOneZipPath, err)
+		}
+		if err := copyFile(originalPath, filepath.Join(outputDir, dayOneZipPath)); err != nil {
+			log.Printf("Warning: Copying media file %s: %v. Skipping this media file.", originalPath, err)
+		}
+	}
+
+	usedNames := make(map[string]bool)
+	for _, entry := range journal.Entries {
+		text := entry.Text
+		for _, id := range entryMediaIdentifiers(entry) {
+			if mediaPath, ok := mediaByIdentifier[id]; ok {
+				text = strings.ReplaceAll(text, "dayone-moment://"+id, mediaPath)
+				text = strings.ReplaceAll(text, "dayone-moment:/video/"+id, mediaPath)
+				text = strings.ReplaceAll(text, "dayone-moment:/audio/"+id, mediaPath)
+			}
+		}
+
+		var content strings.Builder
+		content.WriteString("---\n")
+		if entry.title != "" {
+			titleJSON, _ := json.Marshal(entry.title) // JSON strings are valid YAML scalars
+			content.WriteString("title: " + string(titleJSON) + "\n")
+		}
+		content.WriteString("date: " + entry.CreationDate + "\n")
+		content.WriteString("timezone: " + entry.TimeZone + "\n")
+		content.WriteString("uuid: " + entry.UUID + "\n")
+		if entry.WordCount > 0 {
+			content.WriteString(fmt.Sprintf("words: %d\n", entry.WordCount))
+		}
+		content.WriteString("---\n\n")
+		content.WriteString(text + "\n")
+
+		mdPath := filepath.Join(outputDir, markdownFilename(entry, usedNames, outOpts))
+		if err := os.WriteFile(mdPath, []byte(content.String()), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", mdPath, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// checkWritableDir verifies dir exists, is a directory and files can be created in it.
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+	probe, err := os.CreateTemp(dir, ".write_check_*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// markdownLinkTarget matches the target of markdown links, [text](target).
+var markdownLinkTarget = regexp.MustCompile(`\]\(([^)\s]+)\)`)
+
+// resolveEntryLinks rewrites links to other exported entry files (e.g. "../Entries/2023-12-12.html")
+// into Day One entry links, in the text and the richText. uuidByFile is keyed by the entries' sourceFile,
+// and links are resolved relative to the linking entry's file. Links to entries that weren't converted
+// stay as they are, readable.
+func resolveEntryLinks(entries []DayOneEntry, uuidByFile map[string]string) {
+	resolved := 0
+	for i := range entries {
+		entry := &entries[i]
+		dayOneLink := func(target string) (string, bool) {
+			file := entryLinkFile(entry.sourceFile, target)
+			if file == "" {
+				return "", false
+			}
+			targetUUID, ok := uuidByFile[file]
+			return "dayone://view?entryId=" + targetUUID, ok
+		}
+		entry.Text = markdownLinkTarget.ReplaceAllStringFunc(entry.Text, func(match string) string {
+			link, ok := dayOneLink(markdownLinkTarget.FindStringSubmatch(match)[1])
+			if !ok {
+				return match
+			}
+			resolved++
+			return "](" + link + ")"
+		})
+
+		if entry.RichText == "" {
+			continue
+		}
+		var doc richTextDocument
+		if err := json.Unmarshal([]byte(entry.RichText), &doc); err != nil {
+			continue
+		}
+		changed := false
+		for _, run := range doc.Contents {
+			if run.Attributes == nil || run.Attributes.LinkURL == "" {
+				continue
+			}
+			if link, ok := dayOneLink(run.Attributes.LinkURL); ok {
+				run.Attributes.LinkURL = link
+				changed = true
+			}
+		}
+		if changed {
+			if data, err := json.Marshal(doc); err == nil {
+				entry.RichText = string(data)
+			}
+		}
+	}
+	if resolved > 0 {
+		log.Printf("Resolved %d links between entries.", resolved)
+	}
+}
+
+// entryLinkFile returns the exported entry file a link target in the entry file from points at, relative
+// to the export root like from, or "" if the target isn't a relative link to an HTML file.
+func entryLinkFile(from, target string) string {
+	file := strings.SplitN(target, "#", 2)[0]
+	if isRemoteURL(target) || !isHTMLFile(file) || path.IsAbs(file) {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(file); err == nil {
+		file = unescaped
+	}
+	return path.Join(path.Dir(from), file)
+}
+
+// entryContentKey identifies an entry by its creation date and its text with whitespace collapsed.
+// Moment links are keyed by the media MD5, since each conversion gives media new identifiers.
+func entryContentKey(entry DayOneEntry) string {
+	text := entry.Text
+	for _, p := range entry.Photos {
+		text = strings.ReplaceAll(text, p.Identifier, p.MD5)
+	}
+	for _, v := range entry.Videos {
+		text = strings.ReplaceAll(text, v.Identifier, v.MD5)
+	}
+	for _, a := range entry.Audios {
+		text = strings.ReplaceAll(text, a.Identifier, a.MD5)
+	}
+	sum := sha256.Sum256([]byte(entry.CreationDate + "\x00" + strings.Join(strings.Fields(text), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// dedupEntries drops entries with the same content key as an earlier entry, keeping the first.
+// It returns the kept entries and maps each dropped entry's UUID to the UUID of the one kept.
+func dedupEntries(entries []DayOneEntry) ([]DayOneEntry, map[string]string) {
+	kept := make([]DayOneEntry, 0, len(entries))
+	firstByKey := make(map[string]string)
+	dropped := make(map[string]string)
+	for _, entry := range entries {
+		key := entryContentKey(entry)
+		if firstUUID, ok := firstByKey[key]; ok {
+			dropped[entry.UUID] = firstUUID
+			continue
+		}
+		firstByKey[key] = entry.UUID
+		kept = append(kept, entry)
+	}
+	return kept, dropped
+}
+
+// printAbsPath prints the absolute form of p to stdout for scripts capturing the output path.
+func printAbsPath(p string) {
+	if isS3URL(p) {
+		fmt.Println(p)
+		return
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	fmt.Println(p)
+}
+
+// Localized names of the export's Entries and Resources folders.
+var (
+	entriesFolderNames   = []string{"Entries", "Einträge", "Entrées", "Entradas", "Voci", "Vermeldingen", "Записи", "項目", "エントリ"}
+	resourcesFolderNames = []string{"Resources", "Ressourcen", "Ressources", "Recursos", "Risorse", "Bronnen", "Ресурсы", "資源", "リソース"}
+)
+
+// exportManifestNames are the metadata files looked for next to the Entries folder.
+var exportManifestNames = []string{"manifest.json", "metadata.json", "Info.json"}
+
+// exportMetadataKeys maps manifest fields (compared case-insensitively), and index.html <meta> names,
+// to the Day One journal metadata keys they are recorded under.
+var exportMetadataKeys = map[string]string{
+	"exportdate":  "exportDate",
+	"exportedat":  "exportDate",
+	"date":        "exportDate",
+	"device":      "exportDevice",
+	"devicename":  "exportDevice",
+	"account":     "exportAccount",
+	"accountname": "exportAccount",
+	"appversion":  "exportAppVersion",
+	"generator":   "exportGenerator",
+}
+
+// readExportMetadata collects provenance fields (export date, device, account...) from a JSON manifest
+// or the <meta> tags of index.html in the export root. It returns nil when there is neither.
+func readExportMetadata(exportRoot string) map[string]string {
+	metadata := make(map[string]string)
+	for _, name := range exportManifestNames {
+		data, err := os.ReadFile(filepath.Join(exportRoot, name))
+		if err != nil {
+			continue
+		}
+		var manifest map[string]interface{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			log.Printf("Warning: Ignoring export manifest %s: %v", name, err)
+			continue
+		}
+		for field, value := range manifest {
+			key, ok := exportMetadataKeys[strings.ToLower(field)]
+			if !ok {
+				continue
+			}
+			switch value.(type) {
+			case string, float64, bool:
+				metadata[key] = fmt.Sprint(value)
+			}
+		}
+	}
+	if indexFile, err := os.Open(filepath.Join(exportRoot, "index.html")); err == nil {
+		if doc, err := goquery.NewDocumentFromReader(indexFile); err == nil {
+			doc.Find("meta[name][content]").Each(func(i int, meta *goquery.Selection) {
+				if key, ok := exportMetadataKeys[strings.ToLower(meta.AttrOr("name", ""))]; ok {
+					content := strings.TrimSpace(meta.AttrOr("content", ""))
+					if _, seen := metadata[key]; !seen && content != "" { // The manifest wins
+						metadata[key] = content
+					}
 				}
+			})
+		}
+		indexFile.Close()
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	log.Printf("Recording export metadata in the journal: %v", metadata)
+	return metadata
+}
+
+// exportFolders are the folders of one extracted input zip.
+type exportFolders struct {
+	Root      string // Export root, where manifests are looked for
+	Entries   string
+	Resources string
+}
+
+// expandInputs resolves -i to the zips to convert: a single zip, a directory of zips or a glob
+// such as "exports/*.zip" (for exporters that write one zip per entry), sorted by name. For an
+// iOS backup folder it returns the Journal export (zip or folder) found in the backup.
+func expandInputs(input string) ([]string, error) {
+	if info, err := os.Stat(input); err == nil {
+		if !info.IsDir() {
+			return []string{input}, nil
+		}
+		if isIOSBackup(input) {
+			export, err := findJournalInBackup(input)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Found a Journal export in the iOS backup: %s", export)
+			return []string{export}, nil
+		}
+		dirEntries, err := os.ReadDir(input)
+		if err != nil {
+			return nil, err
+		}
+		var zips []string
+		for _, dirEntry := range dirEntries {
+			if !dirEntry.IsDir() && strings.EqualFold(filepath.Ext(dirEntry.Name()), ".zip") {
+				zips = append(zips, filepath.Join(input, dirEntry.Name()))
+			}
+		}
+		if len(zips) == 0 {
+			return nil, errors.New("the directory contains no .zip files")
+		}
+		return zips, nil // ReadDir sorts by name
+	}
+	zips, err := filepath.Glob(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(zips) == 0 {
+		return []string{input}, nil // Not a pattern (or nothing matches), unzip reports the missing file
+	}
+	sort.Strings(zips)
+	return zips, nil
+}
 
+// iOSBackupMarkers are files at the top of an iOS device backup made by Finder or iTunes.
+var iOSBackupMarkers = []string{"Manifest.db", "Manifest.plist", "Info.plist", "Status.plist"}
 
-				photoUUID := newDayOneUUID()
-				dayOnePhotoFilename := photoUUID + fileExt
-				dayOnePhotoZipPath := filepath.Join("photos", dayOnePhotoFilename)
+// iOSBackupJournalDirs are where a Journal export saved to "On My iPhone" or iCloud Drive ends up
+// in a backup extracted to its domain layout (e.g. by iMazing or idevicebackup2 unback). The Journal
+// app's own container holds a database rather than an export, so entries have to be exported first.
+var iOSBackupJournalDirs = []string{
+	"AppDomainGroup-group.com.apple.FileProvider.LocalStorage/File Provider Storage",
+	"HomeDomain/Library/Mobile Documents/com~apple~CloudDocs",
+	"AppDomainGroup-group.com.apple.journal",
+	"AppDomain-com.apple.journal",
+}
 
-				md5Hash, err := calculateMD5(absImgSrc)
-				if err != nil {
-					log.Printf("Warning: Failed to calculate MD5 for %s: %v", absImgSrc, err)
-					return
-				}
+// isIOSBackup reports whether dir looks like an iOS backup, by its manifest files or domain folders.
+func isIOSBackup(dir string) bool {
+	for _, marker := range iOSBackupMarkers {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			return true
+		}
+	}
+	dirEntries, _ := os.ReadDir(dir)
+	for _, d := range dirEntries {
+		if d.IsDir() && (strings.HasPrefix(d.Name(), "AppDomain") || d.Name() == "HomeDomain") {
+			return true
+		}
+	}
+	return false
+}
 
-				photo := DayOnePhoto{
-					MD5:          md5Hash,
-					Type:         strings.TrimPrefix(fileExt, "."),
-					Identifier:   photoUUID,
-					CreationDate: entry.CreationDate, // Use entry's creation date for photo
+// findJournalInBackup searches the known backup locations for a Journal export: a zip with "journal"
+// in its name, or a folder with an Entries subfolder.
+func findJournalInBackup(backupDir string) (string, error) {
+	found := ""
+	for _, dir := range iOSBackupJournalDirs {
+		root := filepath.Join(backupDir, filepath.FromSlash(dir))
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil // Unreadable parts of the backup are passed over
+			}
+			if d.IsDir() {
+				for _, name := range entriesFolderNames {
+					if strings.EqualFold(d.Name(), name) {
+						found = filepath.Dir(path)
+						return filepath.SkipAll
+					}
 				}
-				entry.Photos = append(entry.Photos, photo)
-				mediaToCopy[absImgSrc] = dayOnePhotoZipPath // Map full path of original file to its new DayOne path
-
-				bodyMarkdownBuilder.WriteString(fmt.Sprintf("![](dayone-moment://%s)\n\n", photoUUID))
-			})
-			return
+			} else if strings.EqualFold(filepath.Ext(d.Name()), ".zip") && strings.Contains(strings.ToLower(d.Name()), "journal") {
+				found = path
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if found != "" {
+			return found, nil
+		}
+	}
+	// Unextracted backups store every file under a hash-named path, looked up in Manifest.db
+	if _, err := os.Stat(filepath.Join(backupDir, "Manifest.db")); err == nil {
+		if _, err := os.Stat(filepath.Join(backupDir, "00")); err == nil {
+			return "", errors.New("this is an iOS backup in its hashed layout; extract it with a backup tool (domain folders such as AppDomainGroup-...) first")
 		}
+	}
+	return "", errors.New("this looks like an iOS backup, but no Journal export was found in it. Journal keeps its entries in a database, " +
+		"so export them from the Journal app to On My iPhone or iCloud Drive before backing up")
+}
 
-		// Handle body text paragraphs (p.p1, p.p2 as per samples, and div.bodyText itself)
-		// The structure is a bit inconsistent:
-		// 2023-12-12: <p class="p1"><span class="s1"><div class='bodyText'>...</div></span></p> <p class="p2">...</p>
-		// 2025-05-14: <p class="p1"><span class="s1">...<div class='bodyText'></span></p><p class="p2">...</p>
-		// We need to get the HTML content of these relevant text blocks.
-		
-		// Attempt to get outer HTML of the selection, then convert
-		htmlContent, err := goquery.OuterHtml(s)
+// copyDir copies the files under src into dst, keeping modification times (for -preserve-mtime).
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
-			log.Printf("Warning: Could not get HTML content for a section in %s: %v", htmlFilePath, err)
-			return
+			return err
 		}
-		// The HTML structure is simple enough that the markdown converter should handle it.
-		// We are primarily interested in <p> tags within div.bodyText or at the same level as title/assetGrid.
-		// Filter for <p> or <div class="bodyText">
-		if s.Is("p") || s.Is("div.bodyText") || s.Parent().Is("div.bodyText") {
-			 currentPContent.WriteString(htmlContent)
-			 convertAndAppendP()
-		} else if s.Find("div.bodyText").Length() > 0 { // If bodyText is a child
-			s.Find("div.bodyText").Each(func(k int, bodyTextSel *goquery.Selection) {
-				bodyHtml, _ := goquery.OuterHtml(bodyTextSel)
-				currentPContent.WriteString(bodyHtml)
-				convertAndAppendP()
-			})
-		} else if s.Find("p").Length() > 0 { // If <p> is a child
-			s.Find("p").Each(func(k int, pSel *goquery.Selection) {
-				pHtml, _ := goquery.OuterHtml(pSel)
-				currentPContent.WriteString(pHtml)
-				convertAndAppendP()
-			})
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if err := copyFile(path, target); err != nil {
+			return err
+		}
+		if info, err := d.Info(); err == nil {
+			os.Chtimes(target, info.ModTime(), info.ModTime())
 		}
+		return nil
 	})
-	convertAndAppendP() // Convert any last paragraph
+}
 
-	entry.Text = strings.TrimSpace(bodyMarkdownBuilder.String())
-	if entryTitle != "" {
-		entry.Text = fmt.Sprintf("# %s\n\n%s", entryTitle, entry.Text)
+// locatePerEntryExport finds the folders of one zip of a per-entry export. Besides the usual
+// Entries/Resources layout these may hold the HTML and its images side by side at the top level.
+func locatePerEntryExport(baseDir string) (exportFolders, bool) {
+	entriesPath, resourcesPath := locateExportFolders(baseDir)
+	if _, err := os.Stat(entriesPath); err == nil {
+		return exportFolders{Root: filepath.Dir(entriesPath), Entries: entriesPath, Resources: resourcesPath}, true
 	}
-
-
-	if entry.Text == "" && len(entry.Photos) == 0 {
-		log.Printf("Warning: Entry %s resulted in no text and no photos. Skipping.", htmlFilePath)
-		return DayOneEntry{}, nil, fmt.Errorf("empty entry after processing %s", htmlFilePath)
+	root := baseDir
+	if dirEntries, err := os.ReadDir(baseDir); err == nil && len(dirEntries) == 1 && dirEntries[0].IsDir() {
+		root = filepath.Join(baseDir, dirEntries[0].Name())
 	}
-
-
-	return entry, mediaToCopy, nil
-}
-
-
-func createDayOneZip(outputZipPath string, journal DayOneJournal, mediaToCopy map[string]string, tempExtractBasePath string) error {
-	zipFile, err := os.Create(outputZipPath)
+	dirEntries, err := os.ReadDir(root)
 	if err != nil {
-		return fmt.Errorf("creating output zip %s: %w", outputZipPath, err)
+		return exportFolders{}, false
+	}
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() && isHTMLFile(dirEntry.Name()) {
+			return exportFolders{Root: root, Entries: root, Resources: root}, true
+		}
 	}
-	defer zipFile.Close()
+	return exportFolders{}, false
+}
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+// locateExportFolders finds the Entries and Resources folders of an extracted export.
+// The folders may be at the top level or inside a single root folder (e.g. "AppleJournalEntries").
+// Known (localized) folder names are tried first, then folders are detected by their contents:
+// a folder of .html files is Entries, a folder of other files is Resources.
+func locateExportFolders(baseDir string) (entriesPath string, resourcesPath string) {
+	root := baseDir
+	filesInTemp, err := os.ReadDir(baseDir)
+	if err == nil && len(filesInTemp) == 1 && filesInTemp[0].IsDir() {
+		// Common case: zip contains a single root folder
+		candidate := filepath.Join(baseDir, filesInTemp[0].Name())
+		if findExportFolder(candidate, entriesFolderNames, true) != "" {
+			root = candidate
+			log.Printf("Detected root folder '%s' in zip. Adjusted paths.", filesInTemp[0].Name())
+		} else {
+			log.Printf("Root folder '%s' detected, but no Entries subfolder found within it. Assuming Entries/Resources are at the top level of the zip.", filesInTemp[0].Name())
+		}
+	}
 
-	// Add Journal.json
-	jsonWriter, err := zipWriter.Create("Journal.json")
-	if err != nil {
-		return fmt.Errorf("creating Journal.json in zip: %w", err)
+	entriesPath = findExportFolder(root, entriesFolderNames, true)
+	if entriesPath == "" {
+		entriesPath = filepath.Join(root, "Entries") // Reported as missing by the caller
 	}
-	jsonData, err := json.MarshalIndent(journal, "", "  ")
+	resourcesPath = findExportFolder(root, resourcesFolderNames, false)
+	if resourcesPath == "" {
+		resourcesPath = filepath.Join(root, "Resources")
+	}
+	return entriesPath, resourcesPath
+}
+
+// findExportFolder returns the subfolder of root matching one of names (case-insensitive),
+// falling back to the first subfolder whose files are HTML (wantHTML) or non-HTML (!wantHTML).
+// It returns "" when nothing matches.
+func findExportFolder(root string, names []string, wantHTML bool) string {
+	dirEntries, err := os.ReadDir(root)
 	if err != nil {
-		return fmt.Errorf("marshalling journal data to JSON: %w", err)
+		return ""
 	}
-	if _, err := jsonWriter.Write(jsonData); err != nil {
-		return fmt.Errorf("writing Journal.json to zip: %w", err)
+	for _, name := range names {
+		for _, d := range dirEntries {
+			if d.IsDir() && strings.EqualFold(d.Name(), name) {
+				return filepath.Join(root, d.Name())
+			}
+		}
 	}
-
-	// Add media files
-	for originalPath, dayOneZipPath := range mediaToCopy {
-		mediaWriter, err := zipWriter.Create(dayOneZipPath)
-		if err != nil {
-			log.Printf("Warning: Creating %s in zip: %v. Skipping this media file.", dayOneZipPath, err)
+	for _, d := range dirEntries {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "__MACOSX") {
 			continue
 		}
-
-		// originalPath is an absolute path to the file in the temp extraction directory
-		mediaFile, err := os.Open(originalPath)
+		files, err := os.ReadDir(filepath.Join(root, d.Name()))
 		if err != nil {
-			log.Printf("Warning: Opening original media file %s: %v. Skipping this media file.", originalPath, err)
 			continue
 		}
-		defer mediaFile.Close() // Close inside loop for each file
+		htmlCount, otherCount := 0, 0
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			if isHTMLFile(f.Name()) {
+				htmlCount++
+			} else {
+				otherCount++
+			}
+		}
+		if (wantHTML && htmlCount > 0 && htmlCount >= otherCount) || (!wantHTML && otherCount > 0 && htmlCount == 0) {
+			log.Printf("Detected folder '%s' by its contents (HTML files: %d, other files: %d)", d.Name(), htmlCount, otherCount)
+			return filepath.Join(root, d.Name())
+		}
+	}
+	return ""
+}
 
-		if _, err := io.Copy(mediaWriter, mediaFile); err != nil {
-			log.Printf("Warning: Copying media file %s to zip: %v. Skipping this media file.", originalPath, err)
+// parseImageTypes turns a -image-types list like "png, .JPG" into a set of lowercase extensions with the dot.
+func parseImageTypes(list string) (map[string]bool, error) {
+	types := make(map[string]bool)
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext == "" {
 			continue
 		}
-		log.Printf("Copied %s to %s in zip.", originalPath, dayOneZipPath)
+		if strings.ContainsAny(ext, "./\\ ") {
+			return nil, fmt.Errorf("'%s' is not a file extension", ext)
+		}
+		types["."+ext] = true
+	}
+	if len(types) == 0 {
+		return nil, errors.New("no extensions given")
 	}
+	return types, nil
+}
+
+// stringListFlag collects the values of a flag that may be given more than once.
+type stringListFlag []string
 
+func (f *stringListFlag) String() string { return strings.Join(*f, ", ") }
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
 	return nil
 }
 
+// matchingExcludePattern returns the first -exclude glob that matches the entry's HTML filename, or "".
+func matchingExcludePattern(name string, patterns []string) string {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched { // Patterns are validated at startup
+			return pattern
+		}
+	}
+	return ""
+}
+
+func isHTMLFile(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".html") || strings.HasSuffix(lower, ".htm")
+}
 
 func main() {
-	inputZip := flag.String("i", "", "Input Apple Journal ZIP file path (required)")
-	outputZip := flag.String("o", "", "Output Day One ZIP file path (required)")
+	inputZip := flag.String("i", "", "Input Apple Journal ZIP file path, a directory or glob of per-entry zips, or an extracted iOS backup folder (required)")
+	outputZip := flag.String("o", "", "Output Day One ZIP file path or s3://bucket/key URL (required)")
 	defaultTimeZone := flag.String("tz", "UTC", "Default Olson TimeZone for entries (e.g., America/New_York)")
+	timeZoneFile := flag.String("tz-per-entry-file", "", "CSV (filename-or-date,timezone) or JSON mapping of entries to Olson timezones, overriding -tz for those entries")
+	noTitleFromFilename := flag.Bool("no-title-from-filename", false, "Don't derive a title from the HTML filename when the entry has none")
+	richText := flag.Bool("rich-text", false, "Also generate Day One's richText field for higher formatting fidelity")
+	stripEmojiFlag := flag.Bool("strip-emoji", false, "Remove emoji (including flags, skin tones and ZWJ sequences) from titles and text, for destinations that render them poorly")
+	flattenMarkdown := flag.Bool("flatten-markdown", false, "Build entry bodies from the HTML text with minimal markdown (paragraphs, line breaks, lists, headings, links) instead of the full converter; faster, drops bold/italics/quotes/code")
+	wordCount := flag.Bool("word-count", false, "Store each entry's word count, counted on its plain-text body, in a wordCount field (and words: in -format markdown front matter); -count reports the totals per year")
+	plainText := flag.Bool("plain-text", false, "Also store each entry's body without markdown syntax in a plainText field, e.g. for search indexing")
+	fetchRemote := flag.Bool("fetch-remote", false, "Download images referenced by http(s) URL and include them as photos")
+	fetchTimeout := flag.Duration("fetch-timeout", 30*time.Second, "Timeout for each remote image download (with -fetch-remote)")
+	dayOneFormat := flag.Bool("dayone-format", false, "Write Journal.json with the spacing and escaping of Day One's own exporter")
+	printOutput := flag.Bool("print-output", false, "On success print only the absolute output path(s) to stdout (logs go to stderr)")
+	selfCheck := flag.Bool("self-check", false, "After writing, reopen the zip and verify Journal.json parses, every referenced media file is present and moment tokens match media files")
+	preserveMtime := flag.Bool("preserve-mtime", false, "Set zip entry timestamps from entry dates (Journal.json) and source file mtimes (media)")
+	debugDir := flag.String("debug-dir", "", "Write HTML fragments the markdown converter fails on to this directory, for bug reports")
+	verboseErrors := flag.Bool("verbose-errors", false, "Log the relevant HTML snippet when an entry is skipped")
+	minDate := flag.String("min-date", journalAppReleaseDate, "Warn about entries dated before this day (YYYY-MM-DD), which usually means a misparsed date (empty to disable)")
+	baseDate := flag.String("base-date", "", "Placeholder date (YYYY-MM-DD) for entries with no header or filename date, instead of skipping them")
+	starSelector := flag.String("star-selector", defaultStarSelector, "CSS selector marking an entry as starred/bookmarked (empty to disable)")
+	pinSelector := flag.String("pin-selector", defaultPinSelector, "CSS selector marking an entry as pinned (empty to disable)")
+	suggestedMode := flag.String("suggested", suggestedInclude, "Entries started from an Apple Journal suggestion with little added text: 'include', 'exclude' or 'only'")
+	suggestedSelector := flag.String("suggested-selector", defaultSuggestedSelector, "CSS selector marking an entry as started from a suggestion (empty to disable)")
+	tagSuggested := flag.Bool("tag-suggested", false, "Tag entries classified as suggestions with 'suggested'")
+	editHistory := flag.String("edit-history", editHistoryLatest, "Previous versions of edited entries, if the export has them: 'latest' (drop them), 'append' (quote them after the text) or 'field' (store them in previousVersions)")
+	revisionSelector := flag.String("revision-selector", defaultRevisionSelector, "CSS selector of blocks holding a previous version of an entry's text (empty to disable)")
+	starredOnly := flag.Bool("starred-only", false, "Only include entries detected as starred/bookmarked")
+	dedupPhotoFormats := flag.Bool("dedup-photo-formats", false, "Keep only the most compatible format when a photo exists as e.g. IMG_1.heic and IMG_1.jpg")
+	tagSource := flag.Bool("tag-source", false, "Tag each entry with source/<filename>.html of the Apple Journal file it came from")
+	tempDir := flag.String("temp-dir", "", "Directory to extract the export into (default: system temp directory)")
+	deviceName := flag.String("device-name", "", "Device name recorded as each entry's creationDevice (e.g. \"Mike's iPhone\")")
+	deviceOS := flag.String("device-os", "", "OS name recorded as each entry's creationOSName (default: inferred from -device-name)")
+	titleFormat := flag.String("title-format", defaultTitleFormat, "Go template for the title added above each entry's text, e.g. '## {{.Title}}', '**{{.Title}}**' or '{{.Title}}'")
+	renameUntitled := flag.String("rename-untitled", "", "Title for entries without one, e.g. \"Untitled\", or \"first-words\" to use the first words of the body (default: leave untitled)")
+	noMedia := flag.Bool("no-media", false, "Convert text only: skip all photos/videos/audio (media-only entries are skipped as empty)")
+	photosSubdirByEntry := flag.Bool("photos-subdir-by-entry", false, "Write media to photos/<entry uuid>/ (and videos/, audios/) instead of one flat folder per media type")
+	maxImageDimension := flag.Int("max-image-dimension", 0, "Downscale photos wider or taller than this many pixels, keeping the aspect ratio (0 keeps originals)")
+	imageTypes := flag.String("image-types", "png,jpg,jpeg,gif", "Comma-separated photo file extensions to import; other grid images are skipped")
+	mediaManifest := flag.String("media-manifest", "", "Also write a CSV of every media file (entry UUID, identifier, source file, MD5, type, dimensions) to this file ('-' for stdout)")
+	listSkipped := flag.String("list-skipped", "", "After converting, list every skipped HTML file with its reason, grouped by reason, to this file ('-' for stdout)")
+	storeKinds := flag.String("store", "", "Write these zip contents uncompressed for speed: 'media' or a comma-separated list of journal, photos, videos, audios (default: deflate everything)")
+	dayoneImport := flag.Bool("dayone-import", false, "After writing the zip, import it with the Day One CLI (dayone2) if it is installed")
+	longTextLimit := flag.Int("long-text-limit", defaultLongTextLimit, "Warn about entries whose text is longer than this many characters (0 disables the check)")
+	splitLong := flag.Bool("split-long", false, "Split entries over -long-text-limit into continuation entries instead of only warning")
+	preserveWhitespace := flag.Bool("preserve-whitespace", false, "Keep monospace-styled text (code, ASCII art, aligned columns) verbatim in fenced code blocks")
+	dedupEntriesFlag := flag.Bool("dedup-entries", false, "Drop entries with the same date and text as an earlier entry (e.g. exported twice), keeping the first")
+	coverPhoto := flag.String("cover-photo", coverPhotoNone, "Which photo Day One shows as an entry's thumbnail: 'first', 'largest' or 'none' (leave it to Day One)")
+	extractBodyTimes := flag.Bool("extract-body-times", false, "For entries whose date has no time of day, use the first time starting a body line (\"9:00 AM - woke up\")")
+	allowEmptyOutput := flag.Bool("allow-empty-output", false, "Write the output even if no entries were converted (by default that is an error)")
+	keepEmpty := flag.Bool("keep-empty", false, "Keep entries that have a date but no text or media, with a placeholder body, instead of skipping them")
+	resume := flag.Bool("resume", false, "Continue an interrupted conversion of the same input, reusing the entries it already converted")
+	diffAgainst := flag.String("diff", "", "Compare the conversion with this existing Day One zip and print added/removed/changed entries, without writing output")
+	checkInput := flag.Bool("check-input", false, "Only check that the input looks like a valid Apple Journal export (Entries/Resources folders, parseable HTML and dates, media present) and list any problems, without converting or writing output")
+	countOnly := flag.Bool("count", false, "Only report entry/photo counts and the date span, without writing any output")
+	sanitizeFilenames := flag.Bool("sanitize-filenames", false, "With -format markdown, build filenames from the title's letters in any script instead of an ASCII slug, within -filename-max-length")
+	filenameReplacement := flag.String("filename-replacement", "-", "Character replacing illegal characters, punctuation, spaces and emoji in sanitized filenames")
+	filenameMaxLength := flag.Int("filename-max-length", 100, "Maximum length of sanitized filenames in bytes, including the date and .md")
+	outputFormat := flag.String("format", "json", "Output format: 'json' (Day One zip), 'jsonl' (zip with Journal.jsonl, one entry per line) or 'markdown' (a directory of .md files, -o is the directory)")
+	journalPerYear := flag.Bool("journal-per-year", false, "Write one zip per year (implies -split-by year) whose journal file is named 'Journal YYYY', so Day One imports each year into its own journal")
+	splitBy := flag.String("split-by", "", "Split output into multiple zips. Supported: 'year' (-o is then used as a directory or file prefix)")
+	var excludePatterns stringListFlag
+	flag.Var(&excludePatterns, "exclude", "Skip entries whose HTML filename matches this glob, e.g. '2023-*' or '*_Private*.html' (repeatable)")
+	var dateLayouts stringListFlag
+	flag.Var(&dateLayouts, "date-layout", "Additional Go time layout for header dates, e.g. '2006-01-02' or '2 January 2006' (repeatable)")
 	flag.Parse()
 
-	if *inputZip == "" || *outputZip == "" {
+	if *inputZip == "" || (*outputZip == "" && !*countOnly && *diffAgainst == "" && !*checkInput) {
 		fmt.Println("Both input (-i) and output (-o) file paths are required.")
 		flag.Usage()
 		os.Exit(1)
 	}
+	if *journalPerYear {
+		if *outputFormat == "markdown" {
+			fmt.Println("-journal-per-year names Day One journals and can't be combined with -format markdown.")
+			os.Exit(1)
+		}
+		if *splitBy == "" {
+			*splitBy = "year"
+		}
+	}
+	if *splitBy != "" && *splitBy != "year" {
+		fmt.Printf("Unsupported -split-by value '%s'. Supported values: year\n", *splitBy)
+		os.Exit(1)
+	}
+	for _, pattern := range excludePatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			fmt.Printf("Invalid -exclude pattern '%s': %v\n", pattern, err)
+			os.Exit(1)
+		}
+	}
+	for _, layout := range dateLayouts {
+		if err := validateDateLayout(layout); err != nil {
+			fmt.Printf("Invalid -date-layout '%s': %v\n", layout, err)
+			os.Exit(1)
+		}
+	}
+	if *coverPhoto != coverPhotoNone && *coverPhoto != coverPhotoFirst && *coverPhoto != coverPhotoLargest {
+		fmt.Printf("Unsupported -cover-photo value '%s'. Supported values: first, largest, none\n", *coverPhoto)
+		os.Exit(1)
+	}
+	if *editHistory != editHistoryLatest && *editHistory != editHistoryAppend && *editHistory != editHistoryField {
+		fmt.Printf("Unsupported -edit-history value '%s'. Supported values: latest, append, field\n", *editHistory)
+		os.Exit(1)
+	}
+	if *suggestedMode != suggestedInclude && *suggestedMode != suggestedExclude && *suggestedMode != suggestedOnly {
+		fmt.Printf("Unsupported -suggested value '%s'. Supported values: include, exclude, only\n", *suggestedMode)
+		os.Exit(1)
+	}
+	if *maxImageDimension < 0 {
+		fmt.Printf("Invalid -max-image-dimension %d, expected a positive number of pixels\n", *maxImageDimension)
+		os.Exit(1)
+	}
+	imageTypeSet, err := parseImageTypes(*imageTypes)
+	if err != nil {
+		fmt.Printf("Invalid -image-types '%s': %v\n", *imageTypes, err)
+		os.Exit(1)
+	}
+	storedKinds, err := parseStoreKinds(*storeKinds)
+	if err != nil {
+		fmt.Printf("Invalid -store '%s': %v\n", *storeKinds, err)
+		os.Exit(1)
+	}
+	titleTemplate, err := parseTitleFormat(*titleFormat)
+	if err != nil {
+		fmt.Printf("Invalid -title-format '%s': %v\n", *titleFormat, err)
+		os.Exit(1)
+	}
+	var entryTimeZones timeZoneMap
+	if *timeZoneFile != "" {
+		if entryTimeZones, err = loadTimeZoneMap(*timeZoneFile); err != nil {
+			fmt.Printf("Invalid -tz-per-entry-file '%s': %v\n", *timeZoneFile, err)
+			os.Exit(1)
+		}
+	}
+	var minDateTime time.Time
+	if *minDate != "" {
+		if minDateTime, err = time.Parse("2006-01-02", *minDate); err != nil {
+			fmt.Printf("Invalid -min-date '%s', expected YYYY-MM-DD: %v\n", *minDate, err)
+			os.Exit(1)
+		}
+	}
+	var baseDateTime time.Time
+	if *baseDate != "" {
+		t, err := time.Parse("2006-01-02", *baseDate)
+		if err != nil {
+			fmt.Printf("Invalid -base-date '%s', expected YYYY-MM-DD: %v\n", *baseDate, err)
+			os.Exit(1)
+		}
+		baseDateTime = time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.UTC)
+	}
+	if *outputFormat != "json" && *outputFormat != "jsonl" && *outputFormat != "markdown" {
+		fmt.Printf("Unsupported -format value '%s'. Supported values: json, jsonl, markdown\n", *outputFormat)
+		os.Exit(1)
+	}
+	if *outputFormat == "jsonl" && *dayOneFormat {
+		fmt.Println("-dayone-format pretty-prints Journal.json and can't be combined with -format jsonl.")
+		os.Exit(1)
+	}
+	if *outputFormat == "markdown" && isS3URL(*outputZip) {
+		fmt.Println("-format markdown writes to a local directory and can't be combined with an s3:// output.")
+		os.Exit(1)
+	}
+	if *dayoneImport && (*outputFormat != "json" || isS3URL(*outputZip)) {
+		fmt.Println("-dayone-import needs a local Day One zip output and can't be combined with -format markdown, -format jsonl or an s3:// output.")
+		os.Exit(1)
+	}
+	if *sanitizeFilenames {
+		if utf8.RuneCountInString(*filenameReplacement) != 1 || strings.ContainsAny(*filenameReplacement, filenameIllegalChars) || unicode.IsControl([]rune(*filenameReplacement)[0]) {
+			fmt.Printf("Invalid -filename-replacement '%s', expected a single character that is allowed in filenames\n", *filenameReplacement)
+			os.Exit(1)
+		}
+		if *filenameMaxLength < minFilenameMaxLength {
+			fmt.Printf("Invalid -filename-max-length %d, expected at least %d bytes\n", *filenameMaxLength, minFilenameMaxLength)
+			os.Exit(1)
+		}
+	}
+	if *outputFormat == "markdown" && *splitBy != "" {
+		fmt.Println("-split-by can't be combined with -format markdown.")
+		os.Exit(1)
+	}
 
-	log.Printf("Starting conversion from %s to %s", *inputZip, *outputZip)
+	if *checkInput {
+		log.Printf("Checking %s (-check-input), no output is written", *inputZip)
+	} else {
+		log.Printf("Starting conversion from %s to %s", *inputZip, *outputZip)
+	}
 
 	// 1. Create temp directory for extraction
-	tempExtractDir, err := os.MkdirTemp("", "applejournal_extract_*")
+	if *tempDir != "" {
+		if err := checkWritableDir(*tempDir); err != nil {
+			log.Fatalf("Invalid -temp-dir %s: %v", *tempDir, err)
+		}
+	}
+	if *debugDir != "" {
+		if err := os.MkdirAll(*debugDir, 0755); err != nil {
+			log.Fatalf("Invalid -debug-dir %s: %v", *debugDir, err)
+		}
+		if err := checkWritableDir(*debugDir); err != nil {
+			log.Fatalf("Invalid -debug-dir %s: %v", *debugDir, err)
+		}
+	}
+	tempExtractDir, err := os.MkdirTemp(*tempDir, "applejournal_extract_*")
 	if err != nil {
 		log.Fatalf("Failed to create temp directory: %v", err)
 	}
@@ -413,102 +5129,437 @@ func main() {
 	}()
 	log.Printf("Temporary extraction directory: %s", tempExtractDir)
 
-	// 2. Unzip input Apple Journal zip
-	log.Printf("Unzipping %s to %s...", *inputZip, tempExtractDir)
-	if err := unzip(*inputZip, tempExtractDir); err != nil {
-		log.Fatalf("Failed to unzip %s: %v", *inputZip, err)
-	}
-	log.Println("Unzip complete.")
-
-	// 3. Determine base paths for Entries and Resources
-	//    The samples imply a folder named "AppleJournalEntries" at the root of the zip.
-	//    Let's check for that, or assume files are at the root of the temp dir.
-	
-	entriesPath := filepath.Join(tempExtractDir, "Entries")
-	resourcesPath := filepath.Join(tempExtractDir, "Resources")
-
-    // Check if the "AppleJournalEntries" folder exists after unzipping
-    // If so, adjust entriesPath and resourcesPath
-    potentialRootFolderName := ""
-    filesInTemp, err := os.ReadDir(tempExtractDir)
-    if err == nil && len(filesInTemp) == 1 && filesInTemp[0].IsDir() {
-        // Common case: zip contains a single root folder
-        potentialRootFolderName = filesInTemp[0].Name()
-        testEntriesPath := filepath.Join(tempExtractDir, potentialRootFolderName, "Entries")
-        if _, err := os.Stat(testEntriesPath); err == nil {
-            entriesPath = testEntriesPath
-            resourcesPath = filepath.Join(tempExtractDir, potentialRootFolderName, "Resources")
-            log.Printf("Detected root folder '%s' in zip. Adjusted paths.", potentialRootFolderName)
-        } else {
-             log.Printf("Root folder '%s' detected, but 'Entries' subfolder not found within it. Assuming Entries/Resources are at the top level of the zip.", potentialRootFolderName)
-			 entriesPath = filepath.Join(tempExtractDir, "Entries") // Fallback to direct subfolders
-			 resourcesPath = filepath.Join(tempExtractDir, "Resources")
-        }
-    }
-
-
-	if _, err := os.Stat(entriesPath); os.IsNotExist(err) {
-		log.Fatalf("Entries folder not found at %s. Please ensure the zip structure is correct (e.g., ZipName/Entries/ or Entries/ at root).", entriesPath)
-	}
-	if _, err := os.Stat(resourcesPath); os.IsNotExist(err) {
-		log.Printf("Warning: Resources folder not found at %s. Media linking might fail.", resourcesPath)
-		// Continue if resources are optional, but log it.
+	inputZips, err := expandInputs(*inputZip)
+	if err != nil {
+		log.Fatalf("Invalid input %s: %v", *inputZip, err)
 	}
+	var exports []exportFolders
+	// entriesRoot is what entry paths are shown relative to in the skip list, and keyed by in the checkpoint
+	var entriesRoot string
+	if len(inputZips) == 1 {
+		// 2. Unzip input Apple Journal zip (an export folder found in an iOS backup is copied instead)
+		if info, err := os.Stat(inputZips[0]); err == nil && info.IsDir() {
+			log.Printf("Copying %s to %s...", inputZips[0], tempExtractDir)
+			if err := copyDir(inputZips[0], filepath.Join(tempExtractDir, filepath.Base(inputZips[0]))); err != nil {
+				log.Fatalf("Failed to copy %s: %v", inputZips[0], err)
+			}
+		} else {
+			log.Printf("Unzipping %s to %s...", inputZips[0], tempExtractDir)
+			if err := unzip(inputZips[0], tempExtractDir); err != nil {
+				log.Fatalf("Failed to unzip %s: %v", inputZips[0], err)
+			}
+			log.Println("Unzip complete.")
+		}
+
+		// 3. Determine base paths for Entries and Resources
+		//    The samples imply a folder named "AppleJournalEntries" at the root of the zip.
+		//    Let's check for that, or assume files are at the root of the temp dir.
+		entriesPath, resourcesPath := locateExportFolders(tempExtractDir)
 
+		if _, err := os.Stat(entriesPath); os.IsNotExist(err) {
+			log.Fatalf("Entries folder not found at %s. Please ensure the zip structure is correct (e.g., ZipName/Entries/ or Entries/ at root).", entriesPath)
+		}
+		if _, err := os.Stat(resourcesPath); os.IsNotExist(err) {
+			log.Printf("Warning: Resources folder not found at %s. Media linking might fail.", resourcesPath)
+			// Continue if resources are optional, but log it.
+		}
+		exports = append(exports, exportFolders{Root: filepath.Dir(entriesPath), Entries: entriesPath, Resources: resourcesPath})
+		entriesRoot = entriesPath
+	} else {
+		// Per-entry zips: each is extracted to its own folder, so equally named files don't overwrite each other
+		log.Printf("Unzipping %d input zips to %s...", len(inputZips), tempExtractDir)
+		for i, zipPath := range inputZips {
+			dest := filepath.Join(tempExtractDir, fmt.Sprintf("%03d_%s", i+1, strings.TrimSuffix(filepath.Base(zipPath), filepath.Ext(zipPath))))
+			if err := unzip(zipPath, dest); err != nil {
+				log.Printf("Warning: Failed to unzip %s: %v. Skipping it.", zipPath, err)
+				continue
+			}
+			export, ok := locatePerEntryExport(dest)
+			if !ok {
+				log.Printf("Warning: No entries found in %s. Skipping it.", zipPath)
+				continue
+			}
+			exports = append(exports, export)
+		}
+		if len(exports) == 0 {
+			log.Fatalf("None of the %d zips matched by %s contain Apple Journal entries.", len(inputZips), *inputZip)
+		}
+		log.Printf("Unzip complete, %d of %d zips contain entries.", len(exports), len(inputZips))
+		entriesRoot = tempExtractDir
+	}
 
 	dayOneJournal := DayOneJournal{
 		Metadata: map[string]string{"version": "1.0"}, // As per Day One example
 		Entries:  make([]DayOneEntry, 0),
 	}
-	// mediaToCopy stores original full path -> new DayOne zip path for all media across all entries
-	allMediaToCopy := make(map[string]string)
+	// Record where the journal came from when the export has a manifest (the first one wins)
+	for _, export := range exports {
+		for key, value := range readExportMetadata(export.Root) {
+			if _, ok := dayOneJournal.Metadata[key]; !ok {
+				dayOneJournal.Metadata[key] = value
+			}
+		}
+	}
+	entryOpts := entryOptions{
+		DefaultTimeZone:    *defaultTimeZone,
+		TimeZoneMap:        entryTimeZones,
+		TitleFromFilename:  !*noTitleFromFilename,
+		RichText:           *richText,
+		PlainText:          *plainText,
+		WordCount:          *wordCount,
+		FlattenMarkdown:    *flattenMarkdown,
+		StripEmoji:         *stripEmojiFlag,
+		VerboseErrors:      *verboseErrors,
+		DebugDir:           *debugDir,
+		StarSelector:       *starSelector,
+		PinSelector:        *pinSelector,
+		SuggestedSelector:  *suggestedSelector,
+		RevisionSelector:   *revisionSelector,
+		EditHistory:        *editHistory,
+		TagSuggested:       *tagSuggested,
+		DedupPhotoFormats:  *dedupPhotoFormats,
+		TagSource:          *tagSource,
+		DeviceName:         *deviceName,
+		DeviceOSName:       *deviceOS,
+		TitleFormat:        titleTemplate,
+		UntitledLabel:      *renameUntitled,
+		NoMedia:            *noMedia,
+		PreserveWhitespace: *preserveWhitespace,
+		ImageTypes:         imageTypeSet,
+		MaxImageDimension:  *maxImageDimension,
+		ConvertedMediaDir:  filepath.Join(tempExtractDir, "converted_media"),
+		MediaSubdirByEntry: *photosSubdirByEntry,
+		BaseDate:           baseDateTime,
+		KeepEmpty:          *keepEmpty,
+		DateLayouts:        dateLayouts,
+		ExtractBodyTimes:   *extractBodyTimes,
+		CoverPhoto:         *coverPhoto,
+		FetchRemote:        *fetchRemote,
+		FetchTimeout:       *fetchTimeout,
+		RemoteMediaDir:     filepath.Join(tempExtractDir, "remote_media"),
+	}
+	outOpts := outputOptions{
+		DayOneFormat:  *dayOneFormat,
+		PreserveMtime: *preserveMtime,
+		SelfCheck:     *selfCheck,
+		JSONLines:     *outputFormat == "jsonl",
+		StoredKinds:   storedKinds,
 
-	log.Printf("Processing HTML entries from: %s", entriesPath)
-	err = filepath.WalkDir(entriesPath, func(path string, d os.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			log.Printf("Error accessing path %s: %v. Skipping.", path, walkErr)
-			return walkErr // Propagate error to stop walking if critical
+		SanitizeFilenames:   *sanitizeFilenames,
+		FilenameReplacement: *filenameReplacement,
+		FilenameMaxLength:   *filenameMaxLength,
+	}
+	if *checkInput {
+		problems := checkExport(exports, tempExtractDir, entryOpts)
+		if problems > 0 {
+			os.RemoveAll(tempExtractDir) // log.Fatalf skips the deferred cleanup
+			log.Fatalf("Found %d problems in %s (listed above).", problems, *inputZip)
 		}
-		if d.IsDir() {
-			return nil // Skip directories
-		}
-		if strings.HasSuffix(strings.ToLower(d.Name()), ".html") || strings.HasSuffix(strings.ToLower(d.Name()), ".htm") {
-			log.Printf("Processing entry: %s", path)
-			entry, entryMedia, procErr := processEntryHTML(path, resourcesPath, *defaultTimeZone)
-			if procErr != nil {
-				log.Printf("Error processing entry %s: %v. Entry skipped.", path, procErr)
-				return nil // Continue with next file even if one fails
-			}
-			// Check if entry is truly empty (e.g. only a date was found but no body/title)
-			if entry.Text == "" && len(entry.Photos) == 0 {
-				log.Printf("Skipping entry %s as it's empty after processing.", path)
-			} else {
-				dayOneJournal.Entries = append(dayOneJournal.Entries, entry)
-				for original, dayOnePath := range entryMedia {
-					allMediaToCopy[original] = dayOnePath
+		fmt.Printf("%s looks like a valid Apple Journal export.\n", *inputZip)
+		return
+	}
+
+	// allMediaToCopy stores new DayOne zip path -> original full path for all media across all entries
+	allMediaToCopy := make(map[string]string)
+	// uuidByFile maps the HTML file of each converted entry, relative to entriesRoot, to its UUID, to resolve
+	// links between entries
+	uuidByFile := make(map[string]string)
+	// skipped lists the skipped entries, and files with missing media, per skipCategory, for the summary and -list-skipped
+	skipped := make(map[string][]skippedEntry)
+	recordSkip := func(path string, err error) {
+		rel, relErr := filepath.Rel(entriesRoot, path)
+		if relErr != nil {
+			rel = path
+		}
+		// Reasons name files by their temp extraction path, show the export-relative ones instead, and
+		// list several reasons (such as each missing media file) on one line
+		reason := strings.ReplaceAll(err.Error(), path, rel)
+		reason = strings.ReplaceAll(reason, entriesRoot+string(filepath.Separator), "")
+		reason = strings.ReplaceAll(reason, "\n", "; ")
+		skipped[skipCategory(err)] = append(skipped[skipCategory(err)], skippedEntry{File: rel, Reason: reason})
+	}
+	excludedNotStarred := 0
+	excludedBySuggested := 0
+	excludedByPattern := 0
+	datedBeforeMin := 0
+	htmlFilesFound := 0
+
+	// Progress is checkpointed so a failed run can be continued with -resume. The checkpoint is removed
+	// once the run completes (log.Fatalf exits without running defers, leaving it for the next run).
+	checkpointFile := checkpointPath(*inputZip, *outputZip, *tempDir)
+	checkpoint := newCheckpoint(*inputZip, entryOpts)
+	if *resume {
+		checkpoint = loadCheckpoint(checkpointFile, *inputZip, entryOpts)
+	}
+	defer os.Remove(checkpointFile)
+	resumedFiles, newSinceSave := 0, 0
+
+	for _, export := range exports {
+		entriesPath, resourcesPath := export.Entries, export.Resources
+		log.Printf("Processing HTML entries from: %s", entriesPath)
+		err = filepath.WalkDir(entriesPath, func(path string, d os.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				log.Printf("Error accessing path %s: %v. Skipping.", path, walkErr)
+				return walkErr // Propagate error to stop walking if critical
+			}
+			if d.IsDir() {
+				return nil // Skip directories
+			}
+			if isHTMLFile(d.Name()) {
+				htmlFilesFound++
+				if pattern := matchingExcludePattern(d.Name(), excludePatterns); pattern != "" {
+					log.Printf("Excluding entry %s (matches -exclude '%s').", path, pattern)
+					excludedByPattern++
+					return nil
+				}
+				relPath, _ := filepath.Rel(entriesRoot, path)
+				entries, entryMedia, resumed := checkpoint.restore(relPath, tempExtractDir)
+				var procErr error
+				if resumed {
+					log.Printf("Resuming entry from checkpoint: %s", path)
+					resumedFiles++
+				} else {
+					log.Printf("Processing entry: %s", path)
+					entries, entryMedia, procErr = processEntryHTML(path, resourcesPath, entryOpts)
+					if procErr == nil {
+						checkpoint.record(relPath, entries, entryMedia, tempExtractDir)
+						if newSinceSave++; newSinceSave >= checkpointInterval {
+							saveCheckpoint(checkpoint, checkpointFile)
+							newSinceSave = 0
+						}
+					}
+				}
+				if procErr != nil && len(entries) == 0 {
+					log.Printf("Error processing entry %s: %v. Entry skipped.", path, procErr)
+					recordSkip(path, procErr)
+					return nil // Continue with next file even if one fails
+				} else if procErr != nil {
+					log.Printf("Error processing part of %s: %v. Those sections or media files were skipped.", path, procErr)
+					recordSkip(path, procErr)
+				}
+				for _, entry := range entries {
+					entry.sourceFile = filepath.ToSlash(relPath)
+					// Check if entry is truly empty (e.g. only a date was found but no body/title)
+					if isEmptyEntry(entry) {
+						log.Printf("Skipping entry %s as it's empty after processing.", path)
+						recordSkip(path, fmt.Errorf("%w after processing %s", ErrEmptyEntry, path))
+					} else if err := validateEntry(entry); err != nil {
+						log.Printf("Warning: Dropping entry %s: %v.", path, err)
+						recordSkip(path, err)
+					} else if *starredOnly && !entry.Starred {
+						excludedNotStarred++
+					} else if (*suggestedMode == suggestedExclude && entry.suggested) || (*suggestedMode == suggestedOnly && !entry.suggested) {
+						excludedBySuggested++
+					} else {
+						if _, ok := uuidByFile[entry.sourceFile]; !ok {
+							uuidByFile[entry.sourceFile] = entry.UUID // Links to a multi-entry file point at its first entry
+						}
+						if created, err := time.Parse(time.RFC3339, entry.CreationDate); err == nil && !minDateTime.IsZero() && created.Before(minDateTime) {
+							log.Printf("Warning: Entry %s is dated %s, before -min-date %s. Check its header date: a misread two-digit year or date format often causes this.", path, created.Format("2006-01-02"), *minDate)
+							datedBeforeMin++
+						}
+						parts := []DayOneEntry{entry}
+						if length := utf8.RuneCountInString(entry.Text); *longTextLimit > 0 && length > *longTextLimit {
+							if *splitLong {
+								parts = splitLongEntry(entry, *longTextLimit, entryOpts.TitleFormat)
+								log.Printf("Entry %s has %d characters, over -long-text-limit %d. Split it into %d entries.", path, length, *longTextLimit, len(parts))
+							} else {
+								log.Printf("Warning: Entry %s has %d characters, over -long-text-limit %d. Day One may truncate or reject it (use -split-long to split it into continuation entries).", path, length, *longTextLimit)
+							}
+						}
+						dayOneJournal.Entries = append(dayOneJournal.Entries, parts...)
+						// Only the media of entries that are kept, a file's other sections may have been dropped
+						for dayOnePath, original := range mediaForEntries([]DayOneEntry{entry}, entryMedia) {
+							if existing, ok := allMediaToCopy[dayOnePath]; ok && existing != original {
+								return fmt.Errorf("media zip path %s generated for both %s and %s", dayOnePath, existing, original)
+							}
+							allMediaToCopy[dayOnePath] = original
+						}
+					}
 				}
 			}
+			return nil
+		})
+
+		if err != nil {
+			log.Fatalf("Error walking through entries directory %s: %v", entriesPath, err)
 		}
-		return nil
-	})
+	}
+	if htmlFilesFound == 0 {
+		// Unlike every entry being skipped, this almost always means the input isn't an Apple Journal export
+		inZip, relErr := filepath.Rel(tempExtractDir, exports[0].Entries)
+		if relErr != nil || len(exports) > 1 {
+			inZip = "the entries folders"
+		}
+		log.Fatalf("No .html or .htm files found in %s of %s. Check that the input is an Apple Journal export (File > Export in Journal), not another zip or an already converted one.", inZip, *inputZip)
+	}
+	if resumedFiles > 0 {
+		log.Printf("Reused %d converted files from the checkpoint.", resumedFiles)
+	}
+	saveCheckpoint(checkpoint, checkpointFile) // So a failure while writing the output resumes without reconverting
 
-	if err != nil {
-		log.Fatalf("Error walking through entries directory %s: %v", entriesPath, err)
+	if *dedupEntriesFlag {
+		var dropped map[string]string
+		dayOneJournal.Entries, dropped = dedupEntries(dayOneJournal.Entries)
+		// Links to a dropped duplicate go to the entry that was kept, and its media is no longer copied
+		for file, entryUUID := range uuidByFile {
+			if keptUUID, ok := dropped[entryUUID]; ok {
+				uuidByFile[file] = keptUUID
+			}
+		}
+		allMediaToCopy = mediaForEntries(dayOneJournal.Entries, allMediaToCopy)
+		log.Printf("Removed %d duplicate entries (-dedup-entries).", len(dropped))
 	}
 
+	// Second pass: now that every entry has a UUID, point links between entries at their Day One counterparts
+	resolveEntryLinks(dayOneJournal.Entries, uuidByFile)
+
 	if len(dayOneJournal.Entries) == 0 {
 		log.Println("No journal entries were successfully processed. Output will be empty.")
 	} else {
 		log.Printf("Processed %d entries.", len(dayOneJournal.Entries))
 	}
+	if *starredOnly {
+		log.Printf("Excluded %d non-starred entries (-starred-only).", excludedNotStarred)
+	}
+	if *suggestedMode == suggestedExclude {
+		log.Printf("Excluded %d suggested entries (-suggested exclude).", excludedBySuggested)
+	} else if *suggestedMode == suggestedOnly {
+		log.Printf("Excluded %d user-written entries (-suggested only).", excludedBySuggested)
+	}
+	if len(excludePatterns) > 0 {
+		log.Printf("Excluded %d entries matching -exclude patterns.", excludedByPattern)
+	}
+	if datedBeforeMin > 0 {
+		log.Printf("Warning: %d entries are dated before -min-date %s; if that's unexpected, check their header dates (-date-layout).", datedBeforeMin, *minDate)
+	}
+	if len(skipped) > 0 {
+		categories := make([]string, 0, len(skipped))
+		for category, entries := range skipped {
+			categories = append(categories, fmt.Sprintf("%s: %d", category, len(entries)))
+		}
+		sort.Strings(categories)
+		log.Printf("Skipped entries and media by reason: %s", strings.Join(categories, ", "))
+	}
+	if *listSkipped != "" {
+		if err := writeSkippedList(*listSkipped, skipped); err != nil {
+			log.Fatalf("Failed to write the skipped entry list: %v", err)
+		}
+	}
+
+	if len(dayOneJournal.Entries) == 0 && !*allowEmptyOutput && !*countOnly && *diffAgainst == "" {
+		// An empty journal almost always means the conversion went wrong, don't leave an empty zip that looks like success
+		log.Fatalf("No entries to write: all %d HTML files were skipped or excluded (see the reasons above, or -list-skipped). Use -allow-empty-output to write an empty output anyway.", htmlFilesFound)
+	}
+	if *countOnly {
+		printJournalStats(dayOneJournal)
+		return
+	}
+	if *diffAgainst != "" {
+		previous, err := readJournalFromZip(*diffAgainst)
+		if err != nil {
+			log.Fatalf("Failed to read %s for -diff: %v", *diffAgainst, err)
+		}
+		log.Printf("Comparing with %s (%d entries); no output is written.", *diffAgainst, len(previous.Entries))
+		printJournalDiff(diffJournals(previous.Entries, dayOneJournal.Entries))
+		return
+	}
+	// Pre-flight: report all media that can't be copied in one place, rather than as warnings while writing
+	dropUnreadableMedia(dayOneJournal.Entries, allMediaToCopy)
+	if *mediaManifest != "" {
+		if err := writeMediaManifest(*mediaManifest, dayOneJournal.Entries, allMediaToCopy, tempExtractDir); err != nil {
+			log.Fatalf("Failed to write the media manifest: %v", err)
+		}
+	}
+
+	// 5. Create output Day One Zip(s)
+	if *outputFormat == "markdown" {
+		log.Printf("Writing Markdown files to: %s", *outputZip)
+		if err := writeMarkdownExport(*outputZip, dayOneJournal, allMediaToCopy, outOpts); err != nil {
+			log.Fatalf("Failed to write Markdown output: %v", err)
+		}
+		log.Println("Conversion complete!")
+		log.Printf("Output written to: %s", *outputZip)
+		if *printOutput {
+			printAbsPath(*outputZip)
+		}
+		return
+	}
 
+	if *splitBy == "year" {
+		yearJournals := splitJournalByYear(dayOneJournal)
+		years := make([]int, 0, len(yearJournals))
+		for year := range yearJournals {
+			years = append(years, year)
+		}
+		sort.Ints(years)
+		for _, year := range years {
+			yearJournal := yearJournals[year]
+			yearZip := splitOutputPath(*outputZip, year)
+			yearMedia := mediaForEntries(yearJournal.Entries, allMediaToCopy)
+			yearOpts := outOpts
+			if *journalPerYear {
+				yearOpts.JournalName = fmt.Sprintf("Journal %d", year)
+			}
+			log.Printf("Creating Day One zip file for %d (%d entries): %s", year, len(yearJournal.Entries), yearZip)
+			// An -o ending in a separator names a directory that may not exist yet
+			if !isS3URL(yearZip) {
+				if err := os.MkdirAll(filepath.Dir(yearZip), 0755); err != nil {
+					log.Fatalf("Failed to create the output directory for %d: %v", year, err)
+				}
+			}
+			if err := createDayOneZip(yearZip, yearJournal, yearMedia, tempExtractDir, yearOpts); err != nil {
+				log.Fatalf("Failed to create Day One zip for %d: %v", year, err)
+			}
+			if *printOutput {
+				printAbsPath(yearZip)
+			}
+			if *dayoneImport {
+				if err := importIntoDayOne(yearZip); err != nil {
+					log.Printf("Warning: Day One import failed: %v", err)
+				}
+			}
+		}
+		log.Println("Conversion complete!")
+		log.Printf("Wrote %d yearly zip files using output prefix: %s", len(years), *outputZip)
+		return
+	}
 
-	// 5. Create output Day One Zip
 	log.Printf("Creating Day One zip file: %s", *outputZip)
-	if err := createDayOneZip(*outputZip, dayOneJournal, allMediaToCopy, tempExtractDir); err != nil {
+	if err := createDayOneZip(*outputZip, dayOneJournal, allMediaToCopy, tempExtractDir, outOpts); err != nil {
 		log.Fatalf("Failed to create Day One zip: %v", err)
 	}
 
 	log.Println("Conversion complete!")
 	log.Printf("Output written to: %s", *outputZip)
+	if *printOutput {
+		printAbsPath(*outputZip)
+	}
+	if *dayoneImport {
+		if err := importIntoDayOne(*outputZip); err != nil {
+			log.Printf("Warning: Day One import failed: %v", err)
+		}
+	}
+}
+
+// dayOneCLI is the Day One command line tool, installed from the Day One app on macOS.
+const dayOneCLI = "dayone2"
+
+// importIntoDayOne imports a written zip with the Day One CLI. A missing CLI is only noted,
+// since the zip can still be imported from the app.
+func importIntoDayOne(zipPath string) error {
+	cliPath, err := exec.LookPath(dayOneCLI)
+	if err != nil {
+		log.Printf("Note: %s is not installed, skipping the import. Import %s from the Day One app instead (File > Import > Day One JSON).", dayOneCLI, zipPath)
+		return nil
+	}
+	log.Printf("Importing %s with %s", zipPath, cliPath)
+	cmd := exec.Command(cliPath, "import", zipPath)
+	// stdout is kept for the output paths of -print-output, the CLI's output goes to stderr like the logs
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s import %s: %w", dayOneCLI, zipPath, err)
+	}
+	return nil
 }